@@ -1,14 +1,20 @@
 package xsv
 
 import (
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 var (
-	ErrEmptyCSVFile = errors.New("empty csv file given")
-	ErrNoStructTags = errors.New("no csv struct tags found")
+	ErrEmptyCSVFile   = errors.New("empty csv file given")
+	ErrNoStructTags   = errors.New("no csv struct tags found")
+	ErrHeaderNotFound = errors.New("no header matching the csv struct tags found")
+	ErrNoTrailer      = errors.New("no trailer found")
+	ErrExtraColumn    = errors.New("extra column not bound to a struct field")
+	ErrUnknownKey     = errors.New("unknown key")
 )
 
 func mismatchStructFields(structInfo []fieldInfo, headers []string) []string {
@@ -100,22 +106,6 @@ func ensureOutInnerType(outInnerType reflect.Type) error {
 	return fmt.Errorf("cannot use " + outInnerType.String() + ", only struct supported")
 }
 
-func ensureOutCapacity(out *reflect.Value, csvLen int) error {
-	switch out.Kind() {
-	case reflect.Array:
-		if out.Len() < csvLen-1 { // Array is not big enough to hold the CSV content (arrays are not addressable)
-			return fmt.Errorf("array capacity problem: cannot store %d %s in %s", csvLen-1, out.Type().Elem().String(), out.Type().String())
-		}
-	case reflect.Slice:
-		if !out.CanAddr() && out.Len() < csvLen-1 { // Slice is not big enough tho hold the CSV content and is not addressable
-			return fmt.Errorf("slice capacity problem and is not addressable (did you forget &?)")
-		} else if out.CanAddr() && out.Len() < csvLen-1 {
-			out.Set(reflect.MakeSlice(out.Type(), csvLen-1, csvLen-1)) // Slice is not big enough, so grows it
-		}
-	}
-	return nil
-}
-
 func getCSVFieldPosition(key string, structInfo *structInfo, curHeaderCount int) *fieldInfo {
 	matchedFieldCount := 0
 	for _, field := range structInfo.Fields {
@@ -129,6 +119,38 @@ func getCSVFieldPosition(key string, structInfo *structInfo, curHeaderCount int)
 	return nil
 }
 
+// positionalFields maps the csv columns to the struct fields for files without headers.
+// When some fields have an index= or pos= tag option only those fields are bound, to their column,
+// otherwise the fields are bound in their declaration order.
+// It fails on the invalid tag options and on the columns bound to several fields.
+func positionalFields(structInfo *structInfo) ([]*fieldInfo, error) {
+	var fields []*fieldInfo
+	for i := range structInfo.Fields {
+		field := &structInfo.Fields[i]
+		if field.positionErr != nil {
+			return nil, field.positionErr
+		}
+		if position := field.position; position >= 0 {
+			if position >= len(fields) {
+				fields = append(fields, make([]*fieldInfo, position+1-len(fields))...)
+			}
+			if fields[position] != nil {
+				return nil, fmt.Errorf("column %d is bound to both %s and %s", position, fields[position].getFirstKey(), field.getFirstKey())
+			}
+			fields[position] = field
+		}
+	}
+	if fields != nil {
+		return fields, nil
+	}
+
+	fields = make([]*fieldInfo, len(structInfo.Fields))
+	for j := range structInfo.Fields {
+		fields[j] = &structInfo.Fields[j]
+	}
+	return fields, nil
+}
+
 func createNewOutInner(outInnerWasPointer bool, outInnerType reflect.Type) reflect.Value {
 	if outInnerWasPointer {
 		return reflect.New(outInnerType)
@@ -180,3 +202,205 @@ func setInnerField(outInner *reflect.Value, outInnerWasPointer bool, index []int
 	}
 	return setField(oi.FieldByIndex(index), value, omitEmpty)
 }
+
+// CellError describes a csv cell that could not be decoded into its struct field
+type CellError struct {
+	Line   int          // line of the record in the csv file
+	Column int          // 1-based position of the cell in the record, as in csv.ParseError
+	Header string       // header of the column, or the struct tag when reading without headers
+	Value  string       // raw content of the cell
+	Type   reflect.Type // type of the struct field the cell was decoded into, nil for the cells not bound to a field
+	Err    error
+}
+
+func (e *CellError) Error() string {
+	if e.Type == nil {
+		return fmt.Sprintf("line %d, column %d: %q: %v", e.Line, e.Column, e.Value, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %d (%s): cannot decode %q into %v: %v", e.Line, e.Column, e.Header, e.Value, e.Type, e.Err)
+}
+
+func (e *CellError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors is returned when XsvRead.MaxErrors is set, it lists every cell that could not be decoded
+type DecodeErrors []*CellError
+
+func (e DecodeErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d cells could not be decoded:", len(e)))
+	for _, cellErr := range e {
+		lines = append(lines, cellErr.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e DecodeErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, cellErr := range e {
+		errs[i] = cellErr
+	}
+	return errs
+}
+
+// recordDecoder holds everything needed to turn a csv record into a struct once the header has been read
+type recordDecoder struct {
+	headers            []string     // normalized csv headers, nil when reading without headers
+	fields             []*fieldInfo // csv column position -> struct field, nil for the columns that are not decoded
+	outInnerWasPointer bool
+	outInnerType       reflect.Type
+	withFields         bool // the struct implements TypeUnmarshalCSVWithFields
+	failIfExtraColumns bool // see XsvRead.FailIfExtraColumns, every cell of a column not bound to a field is an error
+	stripFormulas      bool // see XsvRead.StripFormulaProtection
+	errorHandler       ErrorHandler
+	maxErrors          int          // see XsvRead.MaxErrors
+	errs               DecodeErrors // cell errors collected when maxErrors is not 0
+}
+
+func newRecordDecoder(headers []string, fields []*fieldInfo, outInnerWasPointer bool, outInnerType reflect.Type, errorHandler ErrorHandler, maxErrors int) *recordDecoder {
+	return &recordDecoder{
+		headers:            headers,
+		fields:             fields,
+		outInnerWasPointer: outInnerWasPointer,
+		outInnerType:       outInnerType,
+		withFields:         !outInnerWasPointer && reflect.PtrTo(outInnerType).Implements(unmarshalCSVWithFieldsType),
+		errorHandler:       errorHandler,
+		maxErrors:          maxErrors,
+	}
+}
+
+// decode creates a new struct from a csv record, line is the line of the record in the csv file.
+// Every cell is decoded even if some of them fail; the failures are returned so that handle can be called on them.
+func (d *recordDecoder) decode(record []string, line int) (reflect.Value, []*CellError) {
+	var cellErrs []*CellError
+	if d.failIfExtraColumns {
+		for j, csvColumnContent := range record {
+			if d.field(j) == nil {
+				cellErrs = append(cellErrs, d.newCellError(line, j, nil, csvColumnContent, ErrExtraColumn))
+			}
+		}
+	}
+	if d.withFields {
+		object := reflect.New(d.outInnerType)
+		unmarshaller := object.Interface().(TypeUnmarshalCSVWithFields)
+		for j, csvColumnContent := range record {
+			if fieldInfo := d.field(j); fieldInfo != nil {
+				if err := unmarshaller.UnmarshalCSVWithFields(fieldInfo.getFirstKey(), d.unprotect(fieldInfo, csvColumnContent)); err != nil {
+					cellErrs = append(cellErrs, d.newCellError(line, j, fieldInfo, csvColumnContent, err))
+				}
+			}
+		}
+		return object.Elem(), cellErrs
+	}
+
+	outInner := createNewOutInner(d.outInnerWasPointer, d.outInnerType)
+	oi := outInner
+	if d.outInnerWasPointer {
+		oi = outInner.Elem()
+	}
+	for j, csvColumnContent := range record {
+		if fieldInfo := d.field(j); fieldInfo != nil { // Position found accordingly to header name
+			if err := fieldInfo.setter(oi, d.cellValue(fieldInfo, csvColumnContent)); err != nil { // Set field of struct
+				cellErrs = append(cellErrs, d.newCellError(line, j, fieldInfo, csvColumnContent, err))
+			}
+		}
+	}
+	return outInner, cellErrs
+}
+
+// merge sets the fields of an existing struct from the cells of a record, leaving the fields of the other columns untouched.
+// The record must have been decoded first: the errors of its cells have already been handled and are not reported again.
+func (d *recordDecoder) merge(outInner reflect.Value, record []string) {
+	oi := outInner
+	if d.outInnerWasPointer {
+		oi = outInner.Elem()
+	}
+	if d.withFields {
+		unmarshaller := oi.Addr().Interface().(TypeUnmarshalCSVWithFields)
+		for j, csvColumnContent := range record {
+			if fieldInfo := d.field(j); fieldInfo != nil {
+				_ = unmarshaller.UnmarshalCSVWithFields(fieldInfo.getFirstKey(), d.unprotect(fieldInfo, csvColumnContent))
+			}
+		}
+		return
+	}
+	for j, csvColumnContent := range record {
+		if fieldInfo := d.field(j); fieldInfo != nil {
+			_ = fieldInfo.setter(oi, d.cellValue(fieldInfo, csvColumnContent))
+		}
+	}
+}
+
+// cellValue returns the value a cell sets its struct field to: its content without formula protection, or the default value when empty
+func (d *recordDecoder) cellValue(fieldInfo *fieldInfo, csvColumnContent string) string {
+	if csvColumnContent == "" {
+		return fieldInfo.defaultValue
+	}
+	return d.unprotect(fieldInfo, csvColumnContent)
+}
+
+// unprotect strips the formula protection of a cell when StripFormulaProtection is set, unless its field is raw
+func (d *recordDecoder) unprotect(fieldInfo *fieldInfo, csvColumnContent string) string {
+	if d.stripFormulas && !fieldInfo.raw {
+		return stripFormulaProtection(csvColumnContent)
+	}
+	return csvColumnContent
+}
+
+// field returns the struct field decoded from the csv column j, if any
+func (d *recordDecoder) field(j int) *fieldInfo {
+	if j < len(d.fields) {
+		return d.fields[j]
+	}
+	return nil
+}
+
+func (d *recordDecoder) newCellError(line, j int, fieldInfo *fieldInfo, value string, err error) *CellError {
+	cellErr := &CellError{
+		Line:   line,
+		Column: j + 1,
+		Value:  value,
+		Err:    err,
+	}
+	if fieldInfo != nil {
+		cellErr.Header = fieldInfo.getFirstKey()
+		cellErr.Type = fieldTypeByIndex(d.outInnerType, fieldInfo.IndexChain)
+	}
+	if j < len(d.headers) {
+		cellErr.Header = d.headers[j]
+	}
+	return cellErr
+}
+
+// handle passes the cell errors of a record to the ErrorHandler, in order.
+// It returns the first error the handler did not accept, unless errors are being collected,
+// in which case DecodeErrors is only returned once maxErrors errors have been collected.
+func (d *recordDecoder) handle(cellErrs []*CellError) error {
+	for _, cellErr := range cellErrs {
+		parseError := csv.ParseError{
+			Line:   cellErr.Line,
+			Column: cellErr.Column,
+			Err:    cellErr.Err,
+		}
+		if d.errorHandler != nil && d.errorHandler(&parseError) {
+			continue
+		}
+		if d.maxErrors == 0 {
+			return &parseError
+		}
+		d.errs = append(d.errs, cellErr)
+		if d.maxErrors > 0 && len(d.errs) >= d.maxErrors {
+			return d.errs
+		}
+	}
+	return nil
+}
+
+// collected returns the cell errors collected so far, if any
+func (d *recordDecoder) collected() error {
+	if len(d.errs) == 0 {
+		return nil
+	}
+	return d.errs
+}
@@ -2,8 +2,12 @@ package xsv
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
+	"errors"
+	"io"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
@@ -85,6 +89,271 @@ f,1,baz,,*string,*string`)
 	}
 }
 
+func Test_readTo_rowCountHint(t *testing.T) {
+	var samples []Sample
+	if err := NewXsvRead[Sample]().SetStringReader("foo,BAR\nf,1\ne,2").RowCountHint(100).ReadTo(&samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 sample instances, got %d", len(samples))
+	}
+	if cap(samples) < 100 {
+		t.Fatalf("expected the slice to be pre-sized to 100, got a capacity of %d", cap(samples))
+	}
+
+	// existing elements are overwritten, the slice is not shortened
+	samples = []Sample{{Foo: "x"}, {Foo: "y"}, {Foo: "z"}}
+	if err := NewXsvRead[Sample]().SetStringReader("foo,BAR\n\"f\nf\",1\ne,2").ReadTo(&samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 || samples[0].Foo != "f\nf" || samples[1].Foo != "e" || samples[2].Foo != "z" {
+		t.Fatalf("unexpected samples %v", samples)
+	}
+
+	// line numbers of errors account for records spanning several lines
+	err := NewXsvRead[Sample]().SetStringReader("foo,BAR\n\"f\nf\",1\ne,BAD_INPUT").ReadTo(&samples)
+	if parseErr, ok := err.(*csv.ParseError); !ok || parseErr.Line != 4 {
+		t.Fatalf("expected csv.ParseError on line 4, got %v", err)
+	}
+
+	if err := NewXsvRead[Sample]().SetStringReader("").ReadTo(&samples); err != ErrEmptyCSVFile {
+		t.Fatalf("expected ErrEmptyCSVFile, got %v", err)
+	}
+	if err := NewXsvRead[Sample]().SetStringReader("").ReadToWithoutHeaders(&samples); err != ErrEmptyCSVFile {
+		t.Fatalf("expected ErrEmptyCSVFile, got %v", err)
+	}
+	if err := NewXsvRead[Sample]().SetStringReader("").ReadEach(make(chan Sample)); err != ErrEmptyCSVFile {
+		t.Fatalf("expected ErrEmptyCSVFile, got %v", err)
+	}
+	if err := NewXsvRead[Sample]().SetStringReader("").ReadEachWithoutHeaders(make(chan Sample)); err != nil {
+		t.Fatalf("expected no error without headers, got %v", err)
+	}
+}
+
+func Test_readTo_preamble(t *testing.T) {
+	csvContent := `Monthly statement
+Report generated on 2023-10-01
+
+foo,BAR,Baz
+# a comment
+f,1,baz
+e,BAD_INPUT,b`
+
+	// the lines are only filtered when a preamble or header option is set
+	if NewXsvRead[Sample]().SetStringReader(csvContent).lines != nil {
+		t.Fatal("expected the csv.Reader to read the string directly")
+	}
+
+	var samples []Sample
+	xsvRead := NewXsvRead[Sample]()
+	xsvRead.SkipLines = 3
+	xsvRead.CommentPrefix = "#"
+	err := xsvRead.SetStringReader(csvContent).ReadTo(&samples)
+	if parseErr, ok := err.(*csv.ParseError); !ok || parseErr.Line != 7 {
+		t.Fatalf("expected csv.ParseError on line 7, got %v", err)
+	}
+	if len(samples) != 1 || samples[0].Foo != "f" || samples[0].Bar != 1 {
+		t.Fatalf("unexpected samples %v", samples)
+	}
+
+	xsvRead = NewXsvRead[Sample]()
+	xsvRead.HeaderMinMatches = 2
+	xsvRead.SkipPattern = regexp.MustCompile(`^#`)
+	samples = samples[:0]
+	err = xsvRead.SetStringReader(csvContent).ReadTo(&samples)
+	if parseErr, ok := err.(*csv.ParseError); !ok || parseErr.Line != 7 {
+		t.Fatalf("expected csv.ParseError on line 7, got %v", err)
+	}
+	if len(samples) != 1 || samples[0].Foo != "f" {
+		t.Fatalf("unexpected samples %v", samples)
+	}
+
+	xsvRead.HeaderMinMatches = 4
+	if err := xsvRead.SetStringReader(csvContent).ReadTo(&samples); err != ErrHeaderNotFound {
+		t.Fatalf("expected ErrHeaderNotFound, got %v", err)
+	}
+}
+
+func Test_readTo_malformedPreamble(t *testing.T) {
+	csvContent := `Statement of "ACME Corp
+"Quarterly" report
+foo,BAR,Baz
+# note "unbalanced
+"f
+# not a comment",1,baz
+e,BAD_INPUT,b`
+
+	var samples []Sample
+	xsvRead := NewXsvRead[Sample]()
+	xsvRead.SkipLines = 2
+	xsvRead.CommentPrefix = "#"
+	err := xsvRead.SetStringReader(csvContent).ReadTo(&samples)
+	if parseErr, ok := err.(*csv.ParseError); !ok || parseErr.Line != 7 {
+		t.Fatalf("expected csv.ParseError on line 7, got %v", err)
+	}
+	if len(samples) != 1 || samples[0].Foo != "f\n# not a comment" || samples[0].Bar != 1 {
+		t.Fatalf("unexpected samples %+v", samples)
+	}
+
+	xsvRead = NewXsvRead[Sample]()
+	xsvRead.HeaderMinMatches = 2
+	xsvRead.SkipPattern = regexp.MustCompile(`^# note`)
+	samples = samples[:0]
+	err = xsvRead.SetStringReader(csvContent).ReadTo(&samples)
+	if parseErr, ok := err.(*csv.ParseError); !ok || parseErr.Line != 7 {
+		t.Fatalf("expected csv.ParseError on line 7, got %v", err)
+	}
+	if len(samples) != 1 || samples[0].Bar != 1 {
+		t.Fatalf("unexpected samples %+v", samples)
+	}
+}
+
+func Test_readTo_trailer(t *testing.T) {
+	csvContent := `foo,BAR,Baz
+f,1,baz
+e,3,b
+TOTAL,4,
+END OF FILE`
+
+	var samples []Sample
+	xsvRead := NewXsvRead[Sample]()
+	xsvRead.TrailerSentinel = "TOTAL"
+	xsvReader := xsvRead.SetStringReader(csvContent)
+	if err := xsvReader.ReadTo(&samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[1].Foo != "e" {
+		t.Fatalf("unexpected samples %v", samples)
+	}
+	if trailer := xsvReader.Trailer(); !reflect.DeepEqual(trailer, [][]string{{"TOTAL", "4", ""}, {"END OF FILE"}}) {
+		t.Fatalf("unexpected trailer %v", trailer)
+	}
+	var total TrailerSample
+	if err := xsvReader.DecodeTrailer(&total); err != nil {
+		t.Fatal(err)
+	}
+	if total.Label != "TOTAL" || total.Total != samples[0].Bar+samples[1].Bar {
+		t.Fatalf("unexpected trailer %v", total)
+	}
+
+	xsvRead = NewXsvRead[Sample]()
+	xsvRead.TrailerPattern = regexp.MustCompile(`^TOTAL,`)
+	samples = samples[:0]
+	if err := xsvRead.SetStringReader(csvContent).ReadTo(&samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+
+	xsvRead = NewXsvRead[Sample]()
+	xsvRead.TrailerRecords = 2
+	xsvReader = xsvRead.SetStringReader(csvContent)
+	c := make(chan Sample)
+	go func() {
+		for range c {
+		}
+	}()
+	if err := xsvReader.ReadEachParallel(context.Background(), 2, c); err != nil {
+		t.Fatal(err)
+	}
+	if len(xsvReader.Trailer()) != 2 {
+		t.Fatalf("expected 2 trailer records, got %v", xsvReader.Trailer())
+	}
+
+	mapRead := NewXsvRead[map[string]string]()
+	mapRead.TrailerRecords = 1
+	mapRead.TrailerMatch = func(record []string) bool { return record[0] == "TOTAL" }
+	mapReader := mapRead.SetStringReader(csvContent)
+	rows, err := mapReader.ToMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["foo"] != "f" {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	if trailer := mapReader.Trailer(); len(trailer) != 3 || trailer[0][0] != "e" {
+		t.Fatalf("unexpected trailer %v", trailer)
+	}
+
+	if err := NewXsvRead[Sample]().SetStringReader("foo\nf").DecodeTrailer(&total); err != ErrNoTrailer {
+		t.Fatalf("expected ErrNoTrailer, got %v", err)
+	}
+}
+
+func Test_mergeInto(t *testing.T) {
+	existing := []*Sample{
+		{Foo: "a", Bar: 1, Baz: "keep"},
+		{Foo: "b", Bar: 2, Baz: "keep"},
+	}
+	csvContent := `foo,BAR
+b,20
+z,7`
+	err := MergeInto(NewXsvRead[*Sample]().SetStringReader(csvContent), &existing, func(s *Sample) string { return s.Foo })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existing) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(existing))
+	}
+	if *existing[0] != (Sample{Foo: "a", Bar: 1, Baz: "keep"}) || *existing[1] != (Sample{Foo: "b", Bar: 20, Baz: "keep"}) {
+		t.Fatalf("unexpected merged samples %v %v", existing[0], existing[1])
+	}
+	if existing[2].Foo != "z" || existing[2].Bar != 7 {
+		t.Fatalf("unexpected appended sample %v", existing[2])
+	}
+
+	values := []Sample{{Foo: "a", Bar: 1, Baz: "keep"}}
+	xsvRead := NewXsvRead[Sample]()
+	xsvRead.FailIfUnknownKeys = true
+	err = MergeInto(xsvRead.SetStringReader("foo,Baz\na,changed\nz,new"), &values, func(s Sample) string { return s.Foo })
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+	if len(values) != 1 || values[0] != (Sample{Foo: "a", Bar: 1, Baz: "changed"}) {
+		t.Fatalf("unexpected samples %v", values)
+	}
+}
+
+func Test_readTo_stripFormulaProtection(t *testing.T) {
+	csvContent := `name,formula,amount
+'=1+2,'=SUM(A1:A2),-12.5
+"=""@cmd""",'+x,'not a formula`
+
+	var samples []FormulaSample
+	xsvRead := NewXsvRead[FormulaSample]()
+	xsvRead.StripFormulaProtection = true
+	if err := xsvRead.SetStringReader(csvContent).ReadTo(&samples); err != nil {
+		t.Fatal(err)
+	}
+	expected := []FormulaSample{
+		{Name: "=1+2", Formula: "'=SUM(A1:A2)", Amount: "-12.5"},
+		{Name: "@cmd", Formula: "'+x", Amount: "'not a formula"},
+	}
+	if !reflect.DeepEqual(expected, samples) {
+		t.Fatalf("expected %v, got %v", expected, samples)
+	}
+}
+
+func Test_readTo_formatDirectives(t *testing.T) {
+	csvContent := `price,ratio,flag,code,balance
+$1.50,0.1235,Y,00000042,-00005
+$10.00,2.0000,N,00000000,`
+
+	var samples []FormatSample
+	if err := NewXsvRead[FormatSample]().SetStringReader(csvContent).ReadTo(&samples); err != nil {
+		t.Fatal(err)
+	}
+	balance := -5
+	expected := []FormatSample{
+		{Price: 1.5, Ratio: 0.1235, Flag: true, Code: 42, Balance: &balance},
+		{Price: 10, Ratio: 2, Flag: false, Code: 0, Balance: new(int)},
+	}
+	if !reflect.DeepEqual(expected, samples) {
+		t.Fatalf("expected %v, got %v", expected, samples)
+	}
+}
+
 func Test_readToNormalized(t *testing.T) {
 
 	blah := 0
@@ -332,7 +601,7 @@ ff,gg,22,hh,ii,jj`)
 	var samples []SkipFieldSample
 	go func() {
 		if err := NewXsvRead[SkipFieldSample]().SetReader(csv.NewReader(b)).ReadEach(c); err != nil {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}()
 	for v := range c {
@@ -387,7 +656,7 @@ aa,bb,11,cc,dd,ee`)
 			return sample
 		}
 		if err := xsvRead.SetReader(csv.NewReader(b)).ReadEach(c); err != nil {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}()
 	for v := range c {
@@ -413,6 +682,135 @@ aa,bb,11,cc,dd,ee`)
 	}
 }
 
+func Test_readEachParallel(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("foo,BAR,Baz\n")
+	for i := 0; i < 1000; i++ {
+		if i == 500 {
+			buf.WriteString("f,BAD_INPUT,baz\n")
+			continue
+		}
+		buf.WriteString("f," + strconv.Itoa(i) + ",baz\n")
+	}
+
+	var handled []int
+	var onRecord []int
+	xsvRead := NewXsvRead[Sample]()
+	xsvRead.ErrorHandler = func(err *csv.ParseError) bool {
+		handled = append(handled, err.Line)
+		return true
+	}
+	xsvRead.OnRecord = func(s Sample) Sample {
+		onRecord = append(onRecord, s.Bar)
+		return s
+	}
+	c := make(chan Sample)
+	cerr := make(chan error, 1)
+	go func() {
+		cerr <- xsvRead.SetByteReader(buf.Bytes()).ReadEachParallel(context.Background(), 4, c)
+	}()
+	var samples []Sample
+	for v := range c {
+		samples = append(samples, v)
+	}
+	if err := <-cerr; err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1000 {
+		t.Fatalf("expected 1000 sample instances, got %d", len(samples))
+	}
+	for i, sample := range samples {
+		expected := i
+		if i == 500 {
+			expected = 0
+		}
+		if sample.Bar != expected || onRecord[i] != expected {
+			t.Fatalf("expected sample %d to have BAR %d, got %d", i, expected, sample.Bar)
+		}
+	}
+	if len(handled) != 1 || handled[0] != 502 {
+		t.Fatalf("expected one handled error on line 502, got %v", handled)
+	}
+
+	xsvRead.ErrorHandler = nil
+	c = make(chan Sample)
+	go func() {
+		cerr <- xsvRead.SetByteReader(buf.Bytes()).ReadEachParallel(context.Background(), 4, c)
+	}()
+	samples = samples[:0]
+	for v := range c {
+		samples = append(samples, v)
+	}
+	if err, ok := (<-cerr).(*csv.ParseError); !ok || err.Line != 502 {
+		t.Fatalf("expected csv.ParseError on line 502, got %v", err)
+	}
+	if len(samples) != 500 {
+		t.Fatalf("expected the 500 samples before the error, got %d", len(samples))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c = make(chan Sample)
+	go func() {
+		cerr <- xsvRead.SetByteReader(buf.Bytes()).ReadEachParallel(ctx, 4, c)
+	}()
+	<-c
+	cancel()
+	if err := <-cerr; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func Test_readEachParallel_reuseRecord(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("foo,BAR,Baz\n")
+	for i := 0; i < 2000; i++ {
+		buf.WriteString("f" + strconv.Itoa(i) + "," + strconv.Itoa(i) + ",baz\n")
+	}
+	csvReader := csv.NewReader(&buf)
+	csvReader.ReuseRecord = true
+	c := make(chan Sample)
+	cerr := make(chan error, 1)
+	go func() {
+		cerr <- NewXsvRead[Sample]().SetReader(csvReader).ReadEachParallel(context.Background(), 4, c)
+	}()
+	i := 0
+	for sample := range c {
+		if sample.Foo != "f"+strconv.Itoa(i) || sample.Bar != i {
+			t.Fatalf("expected sample %d to be decoded from its own record, got %+v", i, sample)
+		}
+		i++
+	}
+	if err := <-cerr; err != nil {
+		t.Fatal(err)
+	}
+	if i != 2000 {
+		t.Fatalf("expected 2000 samples, got %d", i)
+	}
+}
+
+func Test_readEachParallel_stalledSource(t *testing.T) {
+	source, sink := io.Pipe()
+	defer sink.Close() // releases the goroutine still reading the source
+	go sink.Write([]byte("foo,BAR,Baz\nf,1,baz\n"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan Sample)
+	cerr := make(chan error, 1)
+	go func() {
+		cerr <- NewXsvRead[Sample]().SetIOReader(source).ReadEachParallel(ctx, 4, c)
+	}()
+	<-c
+	cancel()
+	select {
+	case err := <-cerr:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected ReadEachParallel to return while the source is stalled")
+	}
+}
+
 func Test_readEachWithoutHeaders(t *testing.T) {
 	blah := 0
 	sptr := ""
@@ -423,7 +821,7 @@ e,3,b,,,,`)
 	var samples []Sample
 	go func() {
 		if err := NewXsvRead[Sample]().SetReader(csv.NewReader(b)).ReadEachWithoutHeaders(c); err != nil {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}()
 	for v := range c {
@@ -444,6 +842,199 @@ e,3,b,,,,`)
 	}
 }
 
+func Test_next(t *testing.T) {
+	b := bytes.NewBufferString(`first,foo,BAR,Baz,last,abc
+aa,bb,11,cc,dd,ee
+ff,gg,22,hh,ii,jj`)
+
+	xsvReader := NewXsvRead[SkipFieldSample]().SetReader(csv.NewReader(b))
+	var samples []SkipFieldSample
+	for xsvReader.Next() {
+		samples = append(samples, xsvReader.Value())
+	}
+	if err := xsvReader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 sample instances, got %d", len(samples))
+	}
+	expected := SkipFieldSample{
+		EmbedSample: EmbedSample{
+			Qux: "ff",
+			Sample: Sample{
+				Foo: "gg",
+				Bar: 22,
+				Baz: "hh",
+			},
+			Quux: "ii",
+		},
+		Corge: "jj",
+	}
+	if expected != samples[1] {
+		t.Fatalf("expected second sample %v, got %v", expected, samples[1])
+	}
+	if xsvReader.Next() {
+		t.Fatal("expected Next to return false once the file is consumed")
+	}
+
+	b = bytes.NewBufferString(`foo,BAR,Baz
+f,1,baz
+e,BAD_INPUT,b`)
+	sampleReader := NewXsvRead[Sample]().SetReader(csv.NewReader(b))
+	count := 0
+	for sampleReader.Next() {
+		count++
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 sample instance before the error, got %d", count)
+	}
+	parseErr, ok := sampleReader.Err().(*csv.ParseError)
+	if !ok {
+		t.Fatalf("incorrect error type: %T", sampleReader.Err())
+	}
+	if parseErr.Line != 3 || parseErr.Column != 2 {
+		t.Fatalf("expected csv.ParseError on line 3 column 2, got line %d column %d", parseErr.Line, parseErr.Column)
+	}
+
+	sampleReader = NewXsvRead[Sample]().SetStringReader("")
+	if sampleReader.Next() {
+		t.Fatal("expected Next to return false on an empty file")
+	}
+	if sampleReader.Err() != ErrEmptyCSVFile {
+		t.Fatalf("expected ErrEmptyCSVFile, got %v", sampleReader.Err())
+	}
+}
+
+func Test_all(t *testing.T) {
+	b := bytes.NewBufferString(`foo,BAR,Baz
+f,1,baz
+e,3,b
+g,BAD_INPUT,c`)
+
+	var samples []Sample
+	for sample, err := range NewXsvRead[Sample]().SetReader(csv.NewReader(b)).All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, sample)
+		if len(samples) == 2 {
+			break
+		}
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 sample instances, got %d", len(samples))
+	}
+	if samples[1].Foo != "e" || samples[1].Bar != 3 {
+		t.Fatalf("unexpected second sample %v", samples[1])
+	}
+
+	b = bytes.NewBufferString(`foo,BAR,Baz
+f,1,baz
+g,BAD_INPUT,c`)
+	var errs []error
+	for _, err := range NewXsvRead[Sample]().SetReader(csv.NewReader(b)).All() {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+}
+
+func Test_errorHandler(t *testing.T) {
+	csvContent := `foo,BAR,Baz
+f,BAD_INPUT,baz
+e,3,b`
+	var handled []*csv.ParseError
+	xsvRead := NewXsvRead[Sample]()
+	xsvRead.ErrorHandler = func(err *csv.ParseError) bool {
+		handled = append(handled, err)
+		return true
+	}
+
+	c := make(chan Sample)
+	var samples []Sample
+	go func() {
+		if err := xsvRead.SetStringReader(csvContent).ReadEach(c); err != nil {
+			t.Error(err)
+		}
+	}()
+	for v := range c {
+		samples = append(samples, v)
+	}
+	if len(samples) != 2 || len(handled) != 1 {
+		t.Fatalf("expected 2 samples and 1 handled error, got %d and %d", len(samples), len(handled))
+	}
+	if handled[0].Line != 2 || handled[0].Column != 2 {
+		t.Fatalf("expected handled error on line 2 column 2, got line %d column %d", handled[0].Line, handled[0].Column)
+	}
+
+	handled = handled[:0]
+	samples = samples[:0]
+	if err := xsvRead.SetStringReader("f,BAD_INPUT,baz\ne,3,b").ReadToWithoutHeaders(&samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || len(handled) != 1 {
+		t.Fatalf("expected 2 samples and 1 handled error, got %d and %d", len(samples), len(handled))
+	}
+
+	handled = handled[:0]
+	mapRead := NewXsvRead[map[string]string]()
+	mapRead.ErrorHandler = xsvRead.ErrorHandler
+	rows, err := mapRead.SetStringReader("foo,bar\n1,2\n3\n4,5").ToMap()
+	if !errors.Is(err, csv.ErrFieldCount) || len(handled) != 0 {
+		t.Fatalf("expected csv.ErrFieldCount not passed to the handler, got %v and %d handled errors", rows, len(handled))
+	}
+
+	samples = samples[:0]
+	err = xsvRead.SetStringReader("fo\"o,bar\nx,1\ny,2").ReadTo(&samples)
+	if parseErr, ok := err.(*csv.ParseError); !ok || parseErr.Line != 1 || len(handled) != 0 {
+		t.Fatalf("expected the malformed header to fail on line 1 without calling the handler, got %v and %d handled errors", err, len(handled))
+	}
+}
+
+func Test_maxErrors(t *testing.T) {
+	csvContent := `foo,BAR,Quux
+f,BAD_INPUT,1.5
+e,3,NOT_A_FLOAT
+g,4,2
+h,BAD_AGAIN,3`
+	xsvRead := NewXsvRead[Sample]()
+	xsvRead.MaxErrors = -1
+	var samples []Sample
+	err := xsvRead.SetStringReader(csvContent).ReadTo(&samples)
+	var decodeErrors DecodeErrors
+	if !errors.As(err, &decodeErrors) {
+		t.Fatalf("expected DecodeErrors, got %v", err)
+	}
+	if len(decodeErrors) != 3 {
+		t.Fatalf("expected 3 cell errors, got %d", len(decodeErrors))
+	}
+	expected := CellError{Line: 3, Column: 3, Header: "Quux", Value: "NOT_A_FLOAT", Type: reflect.TypeOf(float64(0))}
+	actual := *decodeErrors[1]
+	actual.Err = nil
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected cell error %+v, got %+v", expected, actual)
+	}
+	if decodeErrors[2].Line != 5 || decodeErrors[2].Header != "BAR" || decodeErrors[2].Type != reflect.TypeOf(0) {
+		t.Fatalf("unexpected cell error %+v", decodeErrors[2])
+	}
+
+	xsvRead.MaxErrors = 2
+	xsvReader := xsvRead.SetStringReader(csvContent)
+	count := 0
+	for xsvReader.Next() {
+		count++
+	}
+	if !errors.As(xsvReader.Err(), &decodeErrors) || len(decodeErrors) != 2 {
+		t.Fatalf("expected 2 cell errors, got %v", xsvReader.Err())
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 sample before reaching MaxErrors, got %d", count)
+	}
+}
+
 func Test_maybeMissingStructFields(t *testing.T) {
 	structTags := []fieldInfo{
 		{keys: []string{"foo"}},
@@ -534,7 +1125,7 @@ e,3,b`)
 	c := make(chan Sample)
 	go func() {
 		if err := xsvRead.SetReader(csv.NewReader(b)).ReadEach(c); err != nil {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}()
 	for v := range c {
@@ -553,7 +1144,7 @@ e,3,b`)
 	c = make(chan Sample)
 	go func() {
 		if err := xsvRead.SetReader(csv.NewReader(b)).ReadEach(c); err == nil {
-			t.Fatal("Double header not allowed but no error raised. Function called is readEach.")
+			t.Error("Double header not allowed but no error raised. Function called is readEach.")
 		}
 	}()
 	for v := range c {
@@ -607,6 +1198,69 @@ ff,gg,22,hh,ii,jj`)
 	}
 }
 
+func TestUnmarshalToCallbackContext(t *testing.T) {
+	b := bytes.NewBufferString(`foo,BAR,Baz
+f,1,baz
+e,3,b
+g,4,c`)
+	callbackErr := errors.New("stop")
+	var samples []Sample
+	err := NewXsvRead[Sample]().SetReader(csv.NewReader(b)).ReadToCallbackContext(context.Background(), func(s Sample) error {
+		samples = append(samples, s)
+		if len(samples) == 2 {
+			return callbackErr
+		}
+		return nil
+	})
+	if err != callbackErr {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 sample instances, got %d", len(samples))
+	}
+
+	b = bytes.NewBufferString(`foo,BAR,Baz
+f,1,baz
+e,3,b`)
+	ctx, cancel := context.WithCancel(context.Background())
+	samples = samples[:0]
+	err = NewXsvRead[Sample]().SetReader(csv.NewReader(b)).ReadToCallbackContext(ctx, func(s Sample) error {
+		samples = append(samples, s)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("expected 1 sample instance, got %d", len(samples))
+	}
+}
+
+func Test_readEachContext(t *testing.T) {
+	b := bytes.NewBufferString(`foo,BAR,Baz
+f,1,baz
+e,3,b
+g,4,c`)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan Sample)
+	cerr := make(chan error)
+	go func() {
+		cerr <- NewXsvRead[Sample]().SetReader(csv.NewReader(b)).ReadEachContext(ctx, c)
+	}()
+	first := <-c
+	if first.Foo != "f" {
+		t.Fatalf("expected first sample foo to be f, got %v", first.Foo)
+	}
+	cancel() // stop reading while the reader is blocked on the channel
+	if err := <-cerr; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, ok := <-c; ok {
+		t.Fatal("expected the channel to be closed")
+	}
+}
+
 // TestRenamedTypes tests for unmarshaling functions on redefined basic types.
 func TestRenamedTypesUnmarshal(t *testing.T) {
 	b := bytes.NewBufferString(`foo;bar
@@ -987,6 +1641,86 @@ func TestUnmarshalCSVWithoutHeaders(t *testing.T) {
 	}
 }
 
+func TestUnmarshalWithoutHeaderPositional(t *testing.T) {
+	csvContent := `1,x,x,12.5,x,a,b,c,x,x
+2,x,x,3,x,d,e,f,x,x`
+
+	var samples []PositionalSample
+	if err := NewXsvRead[PositionalSample]().SetStringReader(csvContent).ReadToWithoutHeaders(&samples); err != nil {
+		t.Fatal(err)
+	}
+	expected := PositionalSample{ID: "1", Amount: 12.5, Codes: []string{"a", "b", "c"}}
+	if !reflect.DeepEqual(expected, samples[0]) {
+		t.Fatalf("expected first sample %v, got %v", expected, samples[0])
+	}
+
+	// extra columns are ignored by default, even without positions
+	var unbound []Sample
+	if err := NewXsvRead[Sample]().SetStringReader("f,1,baz,1.66,,,,extra,extra").ReadToWithoutHeaders(&unbound); err != nil {
+		t.Fatal(err)
+	}
+	if len(unbound) != 1 || unbound[0].Foo != "f" {
+		t.Fatalf("unexpected samples %v", unbound)
+	}
+
+	xsvRead := NewXsvRead[PositionalSample]()
+	xsvRead.FailIfExtraColumns = true
+	err := xsvRead.SetStringReader(csvContent).ReadToWithoutHeaders(&samples)
+	if parseErr, ok := err.(*csv.ParseError); !ok || parseErr.Line != 1 || parseErr.Column != 2 || parseErr.Err != ErrExtraColumn {
+		t.Fatalf("expected ErrExtraColumn on line 1 column 2, the first column between the bound ones, got %v", err)
+	}
+	xsvRead.MaxErrors = -1
+	err = xsvRead.SetStringReader(csvContent).ReadToWithoutHeaders(&samples)
+	var decodeErrors DecodeErrors
+	if !errors.As(err, &decodeErrors) || len(decodeErrors) != 10 {
+		t.Fatalf("expected 5 unbound columns on each line, got %v", err)
+	}
+
+	// a slice of structs is filled element by element from a range
+	type item struct {
+		SKU string `csv:"sku"`
+		Qty int    `csv:"qty"`
+	}
+	type order struct {
+		ID    string `csv:"id,pos=0"`
+		Items []item `csv:"items,pos=2-5"`
+	}
+	var orders []order
+	if err := NewXsvRead[order]().SetStringReader("o1,x,a,1,b,2").ReadToWithoutHeaders(&orders); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (order{ID: "o1", Items: []item{{"a", 1}, {"b", 2}}}); !reflect.DeepEqual(expected, orders[0]) {
+		t.Fatalf("expected %+v, got %+v", expected, orders[0])
+	}
+
+	// invalid positions are reported
+	type notANumber struct {
+		ID string `csv:"id,pos=first"`
+	}
+	if err := NewXsvRead[notANumber]().SetStringReader("1").ReadToWithoutHeaders(&[]notANumber{}); err == nil || !strings.Contains(err.Error(), `invalid column position "first"`) {
+		t.Fatalf("expected an invalid column position error, got %v", err)
+	}
+	type negative struct {
+		ID string `csv:"id,index=-1"`
+	}
+	if err := NewXsvRead[negative]().SetStringReader("1").ReadToWithoutHeaders(&[]negative{}); err == nil || !strings.Contains(err.Error(), `invalid column position "-1"`) {
+		t.Fatalf("expected an invalid column position error, got %v", err)
+	}
+	type duplicate struct {
+		ID   string `csv:"id,pos=0"`
+		Name string `csv:"name,pos=0"`
+	}
+	if err := NewXsvRead[duplicate]().SetStringReader("1").ReadToWithoutHeaders(&[]duplicate{}); err == nil || err.Error() != "column 0 is bound to both id and name" {
+		t.Fatalf("expected a column bound twice error, got %v", err)
+	}
+	type unevenRange struct {
+		Items []item `csv:"items,pos=0-2"`
+	}
+	if err := NewXsvRead[unevenRange]().SetStringReader("a,1,b").ReadToWithoutHeaders(&[]unevenRange{}); err == nil || !strings.Contains(err.Error(), "column range of 3 columns for elements of 2 columns") {
+		t.Fatalf("expected a column range error, got %v", err)
+	}
+}
+
 func TestDecodeDefaultValues(t *testing.T) {
 	type defaultValueStruct struct {
 		Foo string `csv:"foo,default=x"`
@@ -1053,6 +1787,86 @@ func TestUnmarshalCSVToMap(t *testing.T) {
 	}
 }
 
+func Test_getDecodePlan(t *testing.T) {
+	sampleType := reflect.TypeOf(Sample{})
+	identity := func(s string) string { return s }
+	plan := getDecodePlan(sampleType, "csv", ",", identity)
+	if _, ok := decodePlans.Load(decodePlanKey{outInnerType: sampleType, tagName: "csv", tagSeparator: ","}); !ok {
+		t.Fatal("expected the decode plan to be cached")
+	}
+	if lower := getDecodePlan(sampleType, "csv", ",", strings.ToLower); lower.structInfo.Fields[1].getFirstKey() != "bar" || plan.structInfo.Fields[1].getFirstKey() != "BAR" {
+		t.Fatalf("expected the keys to be normalized per call, got %v and %v", lower.structInfo.Fields[1].keys, plan.structInfo.Fields[1].keys)
+	}
+
+	// normalizers made by the same function share their code but not their result
+	prefixer := func(prefix string) Normalizer {
+		return func(s string) string { return prefix + s }
+	}
+	for _, prefix := range []string{"a_", ""} {
+		xsvRead := NewXsvRead[Sample]()
+		xsvRead.NameNormalizer = prefixer(prefix)
+		var samples []Sample
+		if err := xsvRead.SetStringReader("foo,BAR\nf,1").ReadTo(&samples); err != nil {
+			t.Fatal(err)
+		}
+		if samples[0].Foo != "f" || samples[0].Bar != 1 {
+			t.Fatalf("expected the sample to be decoded with the normalizer prefixing %q, got %+v", prefix, samples[0])
+		}
+	}
+	// each component of the nested keys is normalized, a normalizer leaving the dotted names alone still applies to them
+	type city struct {
+		Name string `csv:"Name"`
+	}
+	type address struct {
+		City city `csv:"City"`
+	}
+	nestedRead := NewXsvRead[address]()
+	nestedRead.NameNormalizer = func(s string) string {
+		if strings.Contains(s, ".") {
+			return s
+		}
+		return strings.ToLower(s)
+	}
+	var addresses []address
+	if err := nestedRead.SetStringReader("city.name\nParis").ReadTo(&addresses); err != nil {
+		t.Fatal(err)
+	}
+	if addresses[0].City.Name != "Paris" {
+		t.Fatalf("expected the nested key to be normalized per component, got %+v", addresses[0])
+	}
+
+	for _, field := range plan.structInfo.Fields {
+		if field.setter == nil {
+			t.Fatalf("expected a compiled setter for %v", field.keys)
+		}
+	}
+
+	// slice elements are allocated whatever the order of the columns
+	var samples []SliceStructSample
+	if err := NewXsvRead[SliceStructSample]().SetStringReader("ints[2],s[1].f,ints[0]\n3,1.5,1").ReadTo(&samples); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]int{1, 0, 3}, samples[0].SimpleSlice) || samples[0].Slice[1].Float != 1.5 {
+		t.Fatalf("unexpected sample %+v", samples[0])
+	}
+}
+
+func BenchmarkReadTo(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString("foo,BAR,Baz,Quux,Blah,SPtr,Omit\n")
+	for i := 0; i < 1000; i++ {
+		buf.WriteString("f," + strconv.Itoa(i) + ",baz,1.5,3,ptr,\n")
+	}
+	content := buf.Bytes()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var samples []Sample
+		if err := NewXsvRead[Sample]().SetByteReader(content).ReadTo(&samples); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkCSVToMap(b *testing.B) {
 	bufstring := bytes.NewBufferString(`foo,BAR
 4,Jose
@@ -1116,3 +1930,65 @@ false,email_one,true,email_two,false,email_three`)
 		t.Fatalf("expected \n  sample: %v\n     got: %v", expected, samples)
 	}
 }
+
+func Test_sniff(t *testing.T) {
+	input := "foo;BAR;Baz\r\n\"a;b\";1;x\r\ne;2;y\r\n" + strings.Repeat("f;3;z\r\n", sniffSize/7)
+	xsvRead := NewXsvRead[Sample]()
+	result, replay, err := xsvRead.Sniff(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := SniffResult{Dialect: Dialect{Delimiter: ';', UseCRLF: true}, Quoted: true, HasHeader: true}
+	if result != expected {
+		t.Fatalf("expected %+v, got %+v", expected, result)
+	}
+	xsvRead.Dialect = result.Dialect
+	var out []Sample
+	if err := xsvRead.SetReader(csv.NewReader(replay)).ReadTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2+sniffSize/7 || out[0].Foo != "a;b" || out[len(out)-1].Baz != "z" {
+		t.Fatalf("expected the whole input to be replayed, got %d records", len(out))
+	}
+
+	result, _, err = xsvRead.Sniff(strings.NewReader("a\t1\tx\nb\t2\ty\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = SniffResult{Dialect: Dialect{Delimiter: '\t'}}
+	if result != expected {
+		t.Fatalf("expected %+v, got %+v", expected, result)
+	}
+
+	result, _, err = Sniff(strings.NewReader("name|price|code\nfoo|1.5|AB1\nbar|22|CD2\nbaz|3|EF3|extra\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = SniffResult{Dialect: Dialect{Delimiter: '|', FieldsPerRecord: -1}, HasHeader: true}
+	if result != expected {
+		t.Fatalf("expected %+v, got %+v", expected, result)
+	}
+
+	result, _, err = Sniff(strings.NewReader("foo,1.5\nbar,22\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasHeader {
+		t.Fatal("expected no header")
+	}
+
+	// decimal commas split the fields as evenly as the semicolons, but leave fragments holding the semicolons
+	for _, input := range []string{"foo;1,5\nbar;2,5\n", "1,5;2,5\n3,5;4,5\n"} {
+		result, _, err = Sniff(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Dialect.Delimiter != ';' {
+			t.Fatalf("expected the semicolon delimiter for %q, got %q", input, result.Dialect.Delimiter)
+		}
+	}
+
+	if _, _, err := Sniff(strings.NewReader("\n")); !errors.Is(err, ErrEmptyCSVFile) {
+		t.Fatalf("expected ErrEmptyCSVFile, got %v", err)
+	}
+}
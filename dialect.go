@@ -0,0 +1,46 @@
+package xsv
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+)
+
+// Dialect describes the syntax of a csv file. The same value set on XsvRead and XsvWrite reads back what the writer produced.
+type Dialect struct {
+	Delimiter        rune        // field delimiter, ',' when 0
+	Comment          rune        // lines starting with this rune are skipped on read, and the first fields starting with it are quoted on write; 0 for none
+	QuotePolicy      QuotePolicy // which fields are quoted on write when XsvWrite.QuotePolicy is QuoteMinimal, QuoteNone cannot be read back and is not allowed
+	LazyQuotes       bool        // on read, a quote may appear in an unquoted field and a non-doubled quote in a quoted field
+	TrimLeadingSpace bool        // on read, the leading white space of the fields is ignored
+	FieldsPerRecord  int         // on read, the number of fields of each record: 0 for the number of the first record, negative for any number
+	UseCRLF          bool        // on write, lines end with \r\n instead of \n
+}
+
+var ErrDialectQuoteNone = errors.New("a dialect cannot use QuoteNone since its files cannot be read back")
+
+var (
+	DialectRFC4180        = Dialect{Delimiter: ',', UseCRLF: true}                                        // strict RFC 4180: CRLF line ends, same number of fields in every record
+	DialectExcel          = Dialect{Delimiter: ',', UseCRLF: true, LazyQuotes: true, FieldsPerRecord: -1} // files saved by Excel as "CSV"
+	DialectExcelSemicolon = Dialect{Delimiter: ';', UseCRLF: true, LazyQuotes: true, FieldsPerRecord: -1} // files saved by Excel in the locales using the comma as decimal separator
+	DialectTSV            = Dialect{Delimiter: '\t'}                                                      // tab separated values
+	DialectUnix           = Dialect{Delimiter: ',', QuotePolicy: QuoteAll}                                // every field quoted, \n line ends
+)
+
+// isSet tells whether the dialect has been set, the zero value keeps the settings of the csv.Reader or csv.Writer
+func (d Dialect) isSet() bool {
+	return d != Dialect{}
+}
+
+func (d Dialect) applyToReader(r *csv.Reader) {
+	r.Comma = cmp.Or(d.Delimiter, ',')
+	r.Comment = d.Comment
+	r.LazyQuotes = d.LazyQuotes
+	r.TrimLeadingSpace = d.TrimLeadingSpace
+	r.FieldsPerRecord = d.FieldsPerRecord
+}
+
+func (d Dialect) applyToWriter(w *csv.Writer) {
+	w.Comma = cmp.Or(d.Delimiter, ',')
+	w.UseCRLF = d.UseCRLF
+}
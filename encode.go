@@ -9,6 +9,12 @@ import (
 
 var (
 	ErrChannelIsClosed = errors.New("channel is closed")
+	ErrHeaderWritten   = errors.New("header already written")
+	ErrFooterWritten   = errors.New("footer already written")
+	ErrWriterClosed    = errors.New("writer is closed")
+	ErrHeaderMismatch  = errors.New("the header of the file does not match the columns")
+	ErrExpandSlices    = errors.New("ExpandSlices needs all the rows at once, use Write")
+	ErrUnknownColumn   = errors.New("unknown column")
 )
 
 type encoder struct {
@@ -45,7 +51,8 @@ func ensureInInnerType(outInnerType reflect.Type) error {
 	return fmt.Errorf("cannot use " + outInnerType.String() + ", only struct supported")
 }
 
-func getInnerField(outInner reflect.Value, outInnerWasPointer bool, index []int) (string, error) {
+// getInnerField returns the string representation of the field at index, formatted with format when it is not nil
+func getInnerField(outInner reflect.Value, outInnerWasPointer bool, index []int, format *fieldFormat) (string, error) {
 	oi := outInner
 	if outInnerWasPointer {
 		if oi.IsNil() {
@@ -63,15 +70,22 @@ func getInnerField(outInner reflect.Value, outInnerWasPointer bool, index []int)
 
 		item := oi.Index(i)
 		if len(index) > 1 {
-			return getInnerField(item, false, index[1:])
+			return getInnerField(item, false, index[1:], format)
 		}
-		return getFieldAsString(item)
+		return getFormattedField(item, format)
 	}
 
 	// because pointers can be nil need to recurse one index at a time and perform nil check
 	if len(index) > 1 {
 		nextField := oi.Field(index[0])
-		return getInnerField(nextField, nextField.Kind() == reflect.Ptr, index[1:])
+		return getInnerField(nextField, nextField.Kind() == reflect.Ptr, index[1:], format)
 	}
-	return getFieldAsString(oi.FieldByIndex(index))
+	return getFormattedField(oi.FieldByIndex(index), format)
+}
+
+func getFormattedField(field reflect.Value, format *fieldFormat) (string, error) {
+	if format == nil {
+		return getFieldAsString(field)
+	}
+	return format.format(field)
 }
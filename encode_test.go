@@ -2,10 +2,14 @@ package xsv
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"errors"
 	"io"
 	"math"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -48,6 +52,611 @@ func Test_writeTo(t *testing.T) {
 	assertLine(t, []string{"foo", "BAR", "Baz", "Quux", "Blah", "SPtr", "Omit"}, lines[0])
 	assertLine(t, []string{"f", "1", "baz", "0.1", "2", "*string", ""}, lines[1])
 	assertLine(t, []string{"e", "3", "b", "0.46153846153846156", "", "", ""}, lines[2])
+
+	// the header is written by the first Write only
+	b.Reset()
+	xsvWrite.SelectedColumns = []string{"foo"}
+	xsvWriter := xsvWrite.SetBufferWriter(&b)
+	for _, sample := range s {
+		if err := xsvWriter.Write([]Sample{sample}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.String() != "foo\nf\ne\n" {
+		t.Fatalf("expected a single header, got %q", b.String())
+	}
+}
+
+func Test_writeRow(t *testing.T) {
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[Sample]()
+	xsvWriter := xsvWrite.SetBufferWriter(&b)
+	if err := xsvWriter.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.WriteHeader(); !errors.Is(err, ErrHeaderWritten) {
+		t.Fatalf("expected ErrHeaderWritten, got %v", err)
+	}
+	if err := xsvWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "foo,BAR,Baz,Quux,Blah,SPtr,Omit\n" {
+		t.Fatalf("expected a header-only file, got %q", b.String())
+	}
+
+	if err := xsvWriter.WriteRow(Sample{Foo: "f", Bar: 1, Baz: "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.WriteRows([]Sample{{Foo: "e", Bar: 3}, {Foo: "d", Bar: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.WriteRow(Sample{}); !errors.Is(err, ErrWriterClosed) {
+		t.Fatalf("expected ErrWriterClosed, got %v", err)
+	}
+
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d", len(lines))
+	}
+	assertLine(t, []string{"f", "1", "baz", "0", "", "", ""}, lines[1])
+	assertLine(t, []string{"d", "4", "", "0", "", "", ""}, lines[3])
+
+	// the header is written with the first row
+	b.Reset()
+	ptrWrite := NewXsvWrite[*Sample]()
+	ptrWrite.SelectedColumns = []string{"foo", "BAR"}
+	ptrWrite.SortOrder = []int{1, 0}
+	xsvWriter2 := ptrWrite.SetBufferWriter(&b)
+	if err := xsvWriter2.WriteRow(&Sample{Foo: "f", Bar: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter2.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "BAR,foo\n1,f\n" {
+		t.Fatalf("unexpected output %q", b.String())
+	}
+}
+
+func Test_writeTo_quotePolicy(t *testing.T) {
+	blah := 2
+	s := []Sample{
+		{Foo: `say "hi"`, Bar: 1, Baz: "a,b", Blah: &blah},
+	}
+	tests := []struct {
+		name     string
+		policy   QuotePolicy
+		quote    rune
+		escape   rune
+		expected string
+	}{
+		{"minimal", QuoteMinimal, '"', 0, "foo,BAR,Baz,Quux,Blah,SPtr,Omit\n\"say \"\"hi\"\"\",1,\"a,b\",0,2,,\n"},
+		{"all", QuoteAll, '"', 0, "\"foo\",\"BAR\",\"Baz\",\"Quux\",\"Blah\",\"SPtr\",\"Omit\"\n\"say \"\"hi\"\"\",\"1\",\"a,b\",\"0\",\"2\",\"\",\"\"\n"},
+		{"non numeric", QuoteNonNumeric, '\'', '\\', "'foo','BAR','Baz','Quux','Blah','SPtr','Omit'\n'say \"hi\"',1,'a,b',0,2,'',''\n"},
+		{"none", QuoteNone, '"', 0, "foo,BAR,Baz,Quux,Blah,SPtr,Omit\nsay \\\"hi\\\",1,a\\,b,0,2,,\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := bytes.Buffer{}
+			xsvWrite := NewXsvWrite[Sample]()
+			xsvWrite.QuotePolicy = test.policy
+			xsvWrite.Quote = test.quote
+			xsvWrite.Escape = test.escape
+			if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, b.String())
+			}
+		})
+	}
+
+	xsvWrite := NewXsvWrite[Sample]()
+	xsvWrite.QuotePolicy = QuoteAll
+	if err := xsvWrite.SetWriter(csv.NewWriter(&bytes.Buffer{})).Write(s); !errors.Is(err, ErrQuotingWithoutWriter) {
+		t.Fatalf("expected ErrQuotingWithoutWriter, got %v", err)
+	}
+
+	// any io.Writer can be used with SetIOWriter
+	var builder strings.Builder
+	if err := xsvWrite.SetIOWriter(&builder).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	if expected := tests[1].expected; builder.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, builder.String())
+	}
+}
+
+func Test_writeTo_formulaProtection(t *testing.T) {
+	s := []FormulaSample{
+		{Name: "=1+2", Formula: "=SUM(A1:A2)", Amount: "-12.5"},
+		{Name: "@cmd", Formula: "", Amount: "+3"},
+	}
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[FormulaSample]()
+	xsvWrite.FormulaProtection = FormulaPrefix
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLine(t, []string{"'=1+2", "=SUM(A1:A2)", "-12.5"}, lines[1])
+	assertLine(t, []string{"'@cmd", "", "+3"}, lines[2])
+
+	b.Reset()
+	xsvWrite.FormulaProtection = FormulaWrap
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	lines, err = csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLine(t, []string{`="=1+2"`, "=SUM(A1:A2)", "-12.5"}, lines[1])
+
+	// values that already look protected are protected again, so that reading them back strips only the added protection
+	s = []FormulaSample{
+		{Name: "'-abc", Formula: "'-abc", Amount: `="=x"`},
+		{Name: "''=1", Formula: "", Amount: "'plain"},
+	}
+	xsvRead := NewXsvRead[FormulaSample]()
+	xsvRead.StripFormulaProtection = true
+	for _, protection := range []FormulaProtection{FormulaPrefix, FormulaWrap} {
+		b.Reset()
+		xsvWrite.FormulaProtection = protection
+		if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+			t.Fatal(err)
+		}
+		var samples []FormulaSample
+		if err := xsvRead.SetByteReader(b.Bytes()).ReadTo(&samples); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(s, samples) {
+			t.Fatalf("expected %q to read back as written with protection %d, got %q", b.String(), protection, samples)
+		}
+	}
+
+	// the names of the columns come from data too and are protected like the cells
+	b.Reset()
+	mapWrite := NewXsvWrite[map[string]string]()
+	mapWrite.FormulaProtection = FormulaPrefix
+	mapWrite.AddColumn("@total", func(map[string]string) (string, error) { return "1", nil })
+	if err := mapWrite.SetBufferWriter(&b).Write([]map[string]string{{`=HYPERLINK("x")`: `=HYPERLINK("x")`}}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "\"'=HYPERLINK(\"\"x\"\")\",'@total\n\"'=HYPERLINK(\"\"x\"\")\",1\n" {
+		t.Fatalf("expected the header to be protected, got %q", b.String())
+	}
+	type hyperlink struct {
+		Link string `csv:"=HYPERLINK(\"x\")"`
+	}
+	var links []hyperlink
+	linkRead := NewXsvRead[hyperlink]()
+	linkRead.StripFormulaProtection = true
+	if err := linkRead.SetByteReader(b.Bytes()).ReadTo(&links); err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Link != `=HYPERLINK("x")` {
+		t.Fatalf("expected the protected header to match its field, got %+v", links)
+	}
+
+	// raw as the name of a column is not the raw option
+	type rawName struct {
+		Raw string `csv:"raw"`
+	}
+	b.Reset()
+	rawWrite := NewXsvWrite[rawName]()
+	rawWrite.FormulaProtection = FormulaPrefix
+	if err := rawWrite.SetBufferWriter(&b).Write([]rawName{{"=1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "raw\n'=1\n" {
+		t.Fatalf("expected the column named raw, got %q", b.String())
+	}
+}
+
+func Test_writeTo_append(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "samples.csv")
+	xsvWrite := NewXsvWrite[Sample]()
+	xsvWrite.SelectedColumns = []string{"foo", "BAR"}
+	xsvWrite.HeaderModifier = map[string]string{"BAR": "bar"}
+
+	// the header is written to a new file
+	xsvWriter, err := xsvWrite.SetAppendFileWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.Write([]Sample{{Foo: "f", Bar: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the existing file has its columns in another order and no trailing newline
+	if err := os.WriteFile(name, []byte("bar,foo\n1,f"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	xsvWriter, err = xsvWrite.SetAppendFileWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.Write([]Sample{{Foo: "e", Bar: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "bar,foo\n1,f\n3,e\n" {
+		t.Fatalf("unexpected file content %q", content)
+	}
+
+	// the records take the line ending of the file
+	if err := os.WriteFile(name, []byte("bar,foo\r\n1,f"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	xsvWriter, err = xsvWrite.SetAppendFileWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.Write([]Sample{{Foo: "e", Bar: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := xsvWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if content, err = os.ReadFile(name); err != nil {
+		t.Fatal(err)
+	} else if string(content) != "bar,foo\r\n1,f\r\n3,e\r\n" {
+		t.Fatalf("expected CRLF line endings, got %q", content)
+	}
+
+	// the header is checked when the file is opened
+	xsvWrite.HeaderModifier = map[string]string{}
+	if _, err := xsvWrite.SetAppendFileWriter(name); !errors.Is(err, ErrHeaderMismatch) {
+		t.Fatalf("expected ErrHeaderMismatch, got %v", err)
+	} else if !strings.Contains(err.Error(), `missing columns ["BAR"], unexpected columns ["bar"]`) {
+		t.Fatalf("expected the missing and unexpected columns in the error, got %v", err)
+	}
+	if content, err := os.ReadFile(name); err != nil {
+		t.Fatal(err)
+	} else if string(content) != "bar,foo\r\n1,f\r\n3,e\r\n" {
+		t.Fatalf("expected the file to be left as it was, got %q", content)
+	}
+}
+
+func Test_writeTo_formatDirectives(t *testing.T) {
+	balance := -5
+	s := []FormatSample{
+		{Price: 1.5, Ratio: 0.123456, Flag: true, Code: 42, Balance: &balance},
+		{Price: 10, Ratio: 2, Flag: false, Code: 0},
+	}
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[FormatSample]()
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLine(t, []string{"price", "ratio", "flag", "code", "balance"}, lines[0])
+	assertLine(t, []string{"$1.50", "0.1235", "Y", "00000042", "-00005"}, lines[1])
+	assertLine(t, []string{"$10.00", "2.0000", "N", "00000000", ""}, lines[2])
+
+	// strings are padded too, and cannot start with the pad character that the reader would strip
+	type padded struct {
+		Code  int    `csv:"code,pad=0:8"`
+		Label string `csv:"label,pad=0:8"`
+	}
+	b.Reset()
+	p := []padded{{Code: 12, Label: "42"}, {Code: -3, Label: "-1"}, {Code: 0, Label: ""}}
+	padWrite := NewXsvWrite[padded]()
+	if err := padWrite.SetBufferWriter(&b).Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "code,label\n00000012,00000042\n-0000003,000000-1\n00000000,00000000\n" {
+		t.Fatalf("unexpected padding %q", b.String())
+	}
+	var read []padded
+	if err := NewXsvRead[padded]().SetByteReader(b.Bytes()).ReadTo(&read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, read) {
+		t.Fatalf("expected %q to read back as %+v, got %+v", b.String(), p, read)
+	}
+	if err := padWrite.SetBufferWriter(&b).Write([]padded{{Label: "0012"}}); err == nil || !strings.Contains(err.Error(), "starts with the pad character") {
+		t.Fatalf("expected an error for a string starting with the pad character, got %v", err)
+	}
+}
+
+func Test_writeTo_addColumn(t *testing.T) {
+	s := []Sample{
+		{Foo: "f", Bar: 1, Baz: "baz"},
+		{Foo: "e", Bar: 3, Baz: "b"},
+	}
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[Sample]()
+	xsvWrite.AddColumn("foo_baz", func(s Sample) (string, error) {
+		return s.Foo + s.Baz, nil
+	}).After("foo")
+	xsvWrite.AddColumn("double", func(s Sample) (string, error) {
+		return strconv.Itoa(2 * s.Bar), nil
+	}).At(0)
+	xsvWrite.SelectedColumns = []string{"double", "foo", "foo_baz", "BAR"}
+	xsvWrite.SortOrder = []int{1, 0, 2, 3}
+	xsvWrite.HeaderModifier = map[string]string{"foo_baz": "FooBaz"}
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLine(t, []string{"foo", "double", "FooBaz", "BAR"}, lines[0])
+	assertLine(t, []string{"f", "2", "fbaz", "1"}, lines[1])
+	assertLine(t, []string{"e", "6", "eb", "3"}, lines[2])
+
+	xsvWrite = NewXsvWrite[Sample]()
+	xsvWrite.AddColumn("broken", func(s Sample) (string, error) {
+		return "", errors.New("cannot compute")
+	}).Before("unknown")
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err == nil {
+		t.Fatal("expected an error for a column placed before an unknown column")
+	}
+}
+
+func Test_writeTo_footers(t *testing.T) {
+	blah1, blah2 := 5, -2
+	s := []Sample{
+		{Foo: "f", Bar: 1, Baz: "baz", Frop: 0.5, Blah: &blah1},
+		{Foo: "e", Bar: 3, Baz: "", Frop: 1.5, Blah: &blah2},
+		{Foo: "d", Bar: 4, Baz: "b", Frop: 2.5},
+	}
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[Sample]()
+	xsvWrite.SelectedColumns = []string{"foo", "BAR", "Baz", "Quux", "Blah"}
+	xsvWrite.SortOrder = []int{0, 4, 3, 2, 1}
+	xsvWrite.Footers = map[string]Footer[Sample]{
+		"foo":  {Kind: FooterLabel, Label: "TOTAL"},
+		"BAR":  {Kind: FooterSum},
+		"Baz":  {Kind: FooterCount},
+		"Quux": {Kind: FooterAvg},
+		"Blah": {Kind: FooterMin},
+	}
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d", len(lines))
+	}
+	assertLine(t, []string{"foo", "Blah", "Quux", "Baz", "BAR"}, lines[0])
+	assertLine(t, []string{"TOTAL", "-2", "1.5", "2", "8"}, lines[4])
+
+	b.Reset()
+	reduceWrite := NewXsvWrite[Sample]()
+	reduceWrite.SelectedColumns = []string{"foo", "BAR"}
+	reduceWrite.Footers = map[string]Footer[Sample]{
+		"foo": {Kind: FooterReduce, Reduce: func(state string, s Sample) (string, error) {
+			return state + s.Foo, nil
+		}},
+		"BAR": {Kind: FooterMax},
+	}
+	sampleChan := make(chan Sample, len(s))
+	for _, sample := range s {
+		sampleChan <- sample
+	}
+	close(sampleChan)
+	if err := reduceWrite.SetBufferWriter(&b).WriteFromChan(sampleChan); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(b.String(), "\nfed,4\n") {
+		t.Fatalf("expected the footer after the last row, got %q", b.String())
+	}
+
+	// floats are summed without rounding noise, integers without losing digits past 2^53
+	type amounts struct {
+		Float  float64 `csv:"float"`
+		Int    int64   `csv:"int"`
+		Uint   uint64  `csv:"uint"`
+		Format float64 `csv:"format,precision=3"`
+	}
+	b.Reset()
+	sumWrite := NewXsvWrite[amounts]()
+	sumWrite.Footers = map[string]Footer[amounts]{
+		"float":  {Kind: FooterSum},
+		"int":    {Kind: FooterSum},
+		"uint":   {Kind: FooterMax},
+		"format": {Kind: FooterSum},
+	}
+	a := []amounts{
+		{Float: 0.1, Int: 1 << 53, Uint: math.MaxUint64, Format: 0.1},
+		{Float: 0.2, Int: 1, Uint: 1, Format: 0.2},
+	}
+	if err := sumWrite.SetBufferWriter(&b).Write(a); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(b.String(), "\n0.3,9007199254740993,18446744073709551615,0.300\n") {
+		t.Fatalf("expected exact sums, got %q", b.String())
+	}
+
+	// averages are rounded to two more decimals than their numbers
+	b.Reset()
+	sumWrite.Footers = map[string]Footer[amounts]{"float": {Kind: FooterAvg}, "int": {Kind: FooterAvg}}
+	if err := sumWrite.SetBufferWriter(&b).Write([]amounts{{Float: 1.1, Int: 1}, {Float: 2.2, Int: 2}, {Float: 0, Int: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(b.String(), "\n1.1,1.67,,\n") {
+		t.Fatalf("expected rounded averages, got %q", b.String())
+	}
+
+	b.Reset()
+	sumWrite.Footers = map[string]Footer[amounts]{"int": {Kind: FooterSum}}
+	a = append(a, amounts{Int: math.MaxInt64})
+	if err := sumWrite.SetBufferWriter(&b).Write(a); err == nil || !strings.Contains(err.Error(), "overflows int64") {
+		t.Fatalf("expected the overflow of the sum, got %v", err)
+	}
+}
+
+func Test_writeTo_maps(t *testing.T) {
+	b := bytes.Buffer{}
+	stringWrite := NewXsvWrite[map[string]string]()
+	rows := []map[string]string{
+		{"foo": "f", "bar": "1"},
+		{"bar": "2", "baz": "=b"},
+	}
+	if err := stringWrite.SetBufferWriter(&b).Write(rows); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "bar,foo\n1,f\n2,\n" {
+		t.Fatalf("expected the keys of the first row, got %q", b.String())
+	}
+
+	b.Reset()
+	unionWrite := NewXsvWrite[map[string]string]()
+	unionWrite.MapHeader = MapHeaderUnion
+	unionWrite.FormulaProtection = FormulaPrefix
+	if err := unionWrite.SetBufferWriter(&b).Write(rows); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "bar,baz,foo\n1,,f\n2,'=b,\n" {
+		t.Fatalf("expected the union of the keys, got %q", b.String())
+	}
+	if err := unionWrite.SetBufferWriter(&b).WriteRow(rows[0]); !errors.Is(err, ErrMapHeaderUnion) {
+		t.Fatalf("expected ErrMapHeaderUnion, got %v", err)
+	}
+
+	b.Reset()
+	blah := 3
+	anyWrite := NewXsvWrite[map[string]any]()
+	anyWrite.MapColumns = []string{"int", "float", "ptr", "nil", "slice", "time", "missing"}
+	anyWrite.HeaderModifier = map[string]string{"int": "Int"}
+	anyWrite.Footers = map[string]Footer[map[string]any]{"int": {Kind: FooterSum}}
+	err := anyWrite.SetBufferWriter(&b).Write([]map[string]any{{
+		"int":   1,
+		"float": 0.5,
+		"ptr":   &blah,
+		"nil":   nil,
+		"slice": []int{1, 2},
+		"time":  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"extra": "not written",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	assertLine(t, []string{"Int", "float", "ptr", "nil", "slice", "time", "missing"}, lines[0])
+	assertLine(t, []string{"1", "0.5", "3", "", "[1,2]", "2024-01-02T03:04:05Z", ""}, lines[1])
+	assertLine(t, []string{"1", "", "", "", "", "", ""}, lines[2])
+
+	emptyWrite := NewXsvWrite[map[string]string]()
+	if err := emptyWrite.SetBufferWriter(&b).Write(nil); !errors.Is(err, ErrNoMapColumns) {
+		t.Fatalf("expected ErrNoMapColumns, got %v", err)
+	}
+}
+
+func Test_writeTo_orderedRows(t *testing.T) {
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[OrderedRow]()
+	rowChan := make(chan OrderedRow, 2)
+	rowChan <- OrderedRow{{Name: "z", Value: "first"}, {Name: "a", Value: true}}
+	rowChan <- OrderedRow{{Name: "a", Value: false}, {Name: "b", Value: 2}}
+	close(rowChan)
+	if err := xsvWrite.SetBufferWriter(&b).WriteFromChan(rowChan); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "z,a\nfirst,true\n,false\n" {
+		t.Fatalf("expected the columns of the first row in order, got %q", b.String())
+	}
+
+	emptyChan := make(chan OrderedRow)
+	close(emptyChan)
+	if err := xsvWrite.SetBufferWriter(&b).WriteFromChan(emptyChan); !errors.Is(err, ErrChannelIsClosed) {
+		t.Fatalf("expected ErrChannelIsClosed, got %v", err)
+	}
+}
+
+func Test_writeTo_dialect(t *testing.T) {
+	blah := 2
+	s := []Sample{
+		{Foo: "#not a comment", Bar: 1, Baz: "a,b;c\td", Frop: 0.5, Blah: &blah},
+		{Foo: " leading", Bar: -2, Baz: "say \"hi\"\nbye", Frop: 1.25},
+	}
+	dialects := map[string]Dialect{
+		"RFC4180":        DialectRFC4180,
+		"Excel":          DialectExcel,
+		"ExcelSemicolon": DialectExcelSemicolon,
+		"TSV":            DialectTSV,
+		"Unix":           DialectUnix,
+		"comment":        {Delimiter: ';', Comment: '#', TrimLeadingSpace: true},
+	}
+	for name, dialect := range dialects {
+		t.Run(name, func(t *testing.T) {
+			b := bytes.Buffer{}
+			xsvWrite := NewXsvWrite[Sample]()
+			xsvWrite.Dialect = dialect
+			if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+				t.Fatal(err)
+			}
+			if dialect.UseCRLF != strings.Contains(b.String(), "\r\n") {
+				t.Fatalf("expected UseCRLF %v, got %q", dialect.UseCRLF, b.String())
+			}
+
+			xsvRead := NewXsvRead[Sample]()
+			xsvRead.Dialect = dialect
+			var out []Sample
+			if err := xsvRead.SetByteReader(b.Bytes()).ReadTo(&out); err != nil {
+				t.Fatal(err)
+			}
+			if len(out) != len(s) {
+				t.Fatalf("expected %d records, got %d", len(s), len(out))
+			}
+			for i := range s {
+				if out[i].Foo != s[i].Foo || out[i].Bar != s[i].Bar || out[i].Baz != s[i].Baz || out[i].Frop != s[i].Frop {
+					t.Fatalf("expected %v, got %v", s[i], out[i])
+				}
+			}
+		})
+	}
+
+	b := bytes.Buffer{}
+	unixWrite := NewXsvWrite[Sample]()
+	unixWrite.Dialect = DialectUnix
+	unixWrite.SelectedColumns = []string{"foo", "BAR"}
+	if err := unixWrite.SetBufferWriter(&b).Write(s[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "\"foo\",\"BAR\"\n\"#not a comment\",\"1\"\n" {
+		t.Fatalf("expected every field quoted, got %q", b.String())
+	}
+
+	noneWrite := NewXsvWrite[Sample]()
+	noneWrite.Dialect = Dialect{QuotePolicy: QuoteNone}
+	if err := noneWrite.SetBufferWriter(&b).Write(s); !errors.Is(err, ErrDialectQuoteNone) {
+		t.Fatalf("expected ErrDialectQuoteNone, got %v", err)
+	}
 }
 
 func Test_writeTo_OnRecord(t *testing.T) {
@@ -207,6 +816,49 @@ func Test_writeTo_slice(t *testing.T) {
 	assertLine(t, []string{"test2", "[4,5,6]"}, lines[2])
 }
 
+func Test_writeTo_expandSlices(t *testing.T) {
+	type LineItem struct {
+		SKU string `csv:"sku"`
+		Qty int    `csv:"qty"`
+	}
+	type Shipping struct {
+		Tags []string `csv:"tags"`
+	}
+	type Order struct {
+		ID       string     `csv:"id"`
+		Items    []LineItem `csv:"item"`
+		Codes    []int      `csv:"code"`
+		Fixed    []int      `csv:"fixed" csv[]:"1"`
+		Empty    []string   `csv:"empty"`
+		Shipping *Shipping  `csv:"ship"`
+	}
+
+	s := []Order{
+		{ID: "o1", Items: []LineItem{{SKU: "a", Qty: 1}}, Codes: []int{7, 8, 9}, Fixed: []int{1, 2}},
+		{ID: "o2", Items: []LineItem{{SKU: "b", Qty: 2}, {SKU: "c", Qty: 3}}, Shipping: &Shipping{Tags: []string{"x"}}},
+	}
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[Order]()
+	xsvWrite.ExpandSlices = true
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	assertLine(t, []string{"id", "item[0].sku", "item[0].qty", "item[1].sku", "item[1].qty", "code[0]", "code[1]", "code[2]", "fixed[0]", "ship.tags[0]"}, lines[0])
+	assertLine(t, []string{"o1", "a", "1", "", "", "7", "8", "9", "1", ""}, lines[1])
+	assertLine(t, []string{"o2", "b", "2", "c", "3", "", "", "", "", "x"}, lines[2])
+
+	if err := xsvWrite.SetBufferWriter(&b).WriteRow(s[0]); !errors.Is(err, ErrExpandSlices) {
+		t.Fatalf("expected ErrExpandSlices, got %v", err)
+	}
+}
+
 func Test_writeTo_slice_structs(t *testing.T) {
 	b := bytes.Buffer{}
 	e := &encoder{out: &b}
@@ -548,9 +1200,61 @@ func Test_MarshalChan_ClosedChannel(t *testing.T) {
 	sampleChan := make(chan Sample)
 	close(sampleChan)
 
-	if err := xsvWrite.SetWriter(csv.NewWriter(e.out)).WriteFromChan(sampleChan); !errors.Is(err, ErrChannelIsClosed) {
+	if err := xsvWrite.SetWriter(csv.NewWriter(e.out)).WriteFromChan(sampleChan); err != nil {
 		t.Fatal(err)
 	}
+	if b.String() != "foo,BAR,Baz,Quux,Blah,SPtr,Omit\n" {
+		t.Fatalf("expected a header-only file, got %q", b.String())
+	}
+}
+
+type sampleRow interface {
+	isSampleRow()
+}
+
+func (s *Sample) isSampleRow() {}
+
+func Test_writeToChan_interface(t *testing.T) {
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[sampleRow]()
+	xsvWrite.SelectedColumns = []string{"foo", "BAR"}
+	sampleChan := make(chan sampleRow, 2)
+	sampleChan <- &Sample{Foo: "f", Bar: 1}
+	sampleChan <- &Sample{Foo: "e", Bar: 3}
+	close(sampleChan)
+	if err := xsvWrite.SetBufferWriter(&b).WriteFromChan(sampleChan); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "foo,BAR\nf,1\ne,3\n" {
+		t.Fatalf("unexpected output %q", b.String())
+	}
+
+	emptyChan := make(chan sampleRow)
+	close(emptyChan)
+	if err := xsvWrite.SetBufferWriter(&b).WriteFromChan(emptyChan); !errors.Is(err, ErrChannelIsClosed) {
+		t.Fatalf("expected ErrChannelIsClosed, got %v", err)
+	}
+}
+
+func Test_writeToChanContext(t *testing.T) {
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[Sample]()
+	sampleChan := make(chan Sample)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		sampleChan <- Sample{Foo: "f", Bar: 1}
+		cancel()
+	}()
+	if err := xsvWrite.SetBufferWriter(&b).WriteFromChanContext(ctx, sampleChan); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected the rows written before cancellation to be flushed, got %v", lines)
+	}
 }
 
 // TestRenamedTypes tests for marshaling functions on redefined basic types.
@@ -679,6 +1383,88 @@ func Test_writeTo_nested_struct(t *testing.T) {
 	assertLine(t, []string{"false", "email_one", "true", "email_two", "false", "email_three"}, lines[1])
 }
 
+func Test_writeTo_columns(t *testing.T) {
+	b := bytes.Buffer{}
+	s := []NestedSample{{
+		Inner1: InnerStruct{StringField2: "email_one"},
+		Inner2: InnerStruct{BoolField1: true, StringField2: "email_two"},
+		Inner3: NestedEmbedSample{InnerStruct{StringField2: "email_three"}},
+	}}
+	xsvWrite := NewXsvWrite[NestedSample]()
+	xsvWrite.Columns = []string{"two.stringField2", "*", "one.boolField1"}
+	if err := xsvWrite.SetBufferWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLine(t, []string{"two.stringField2", "one.stringField2", "two.boolField1", "three.boolField1", "three.stringField2", "one.boolField1"}, lines[0])
+	assertLine(t, []string{"email_two", "email_one", "true", "false", "email_three", "false"}, lines[1])
+
+	b.Reset()
+	sliceWrite := NewXsvWrite[SliceStructSample]()
+	sliceWrite.Columns = []string{"s[1].s", "ints[0]"}
+	err = sliceWrite.SetBufferWriter(&b).Write([]SliceStructSample{{Slice: []SliceStruct{{String: "s1"}, {String: "s2"}}, SimpleSlice: []int{1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "s[1].s,ints[0]\ns2,1\n" {
+		t.Fatalf("expected the listed columns only, got %q", b.String())
+	}
+
+	unknownWrite := NewXsvWrite[NestedSample]()
+	unknownWrite.Columns = []string{"one.boolField1", "four.boolField1"}
+	if err := unknownWrite.SetBufferWriter(&b).Write(s); !errors.Is(err, ErrUnknownColumn) || !strings.Contains(err.Error(), "four.boolField1") {
+		t.Fatalf("expected ErrUnknownColumn for four.boolField1, got %v", err)
+	}
+
+	sortWrite := NewXsvWrite[Sample]()
+	sortWrite.SelectedColumns = []string{"foo", "BAR", "Baz"}
+	sortWrite.SortOrder = []int{0, 2, 2}
+	if err := sortWrite.SetBufferWriter(&b).Write([]Sample{{}}); err == nil {
+		t.Fatal("expected an error for a SortOrder that is not a permutation")
+	}
+}
+
+func Test_writeTo_orderTag(t *testing.T) {
+	type Address struct {
+		City string `csv:"city"`
+		Zip  string `csv:"zip"`
+	}
+	type Customer struct {
+		Name    string  `csv:"name"`
+		Address Address `csv:"addr,order=2"`
+		ID      int     `csv:"id,order=-1"`
+		Email   string  `csv:"email,order=1"`
+		Phone   string  `csv:"phone"`
+	}
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[Customer]()
+	err := xsvWrite.SetBufferWriter(&b).Write([]Customer{{Name: "n", Address: Address{City: "c", Zip: "z"}, ID: 1, Email: "e", Phone: "p"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "id,email,addr.city,addr.zip,name,phone\n1,e,c,z,n,p\n" {
+		t.Fatalf("expected the columns sorted by order, got %q", b.String())
+	}
+
+	// an ordered field comes first, even with order=0, and the others follow in the order of the struct
+	type abc struct {
+		A string `csv:"a"`
+		B string `csv:"b,order=0"`
+		C string `csv:"c"`
+	}
+	b.Reset()
+	abcWrite := NewXsvWrite[abc]()
+	if err := abcWrite.SetBufferWriter(&b).Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "b,a,c\n" {
+		t.Fatalf("expected the ordered column first, got %q", b.String())
+	}
+}
+
 func Test_writeTo_emptyptr_selectedColumns(t *testing.T) {
 
 	b := bytes.Buffer{}
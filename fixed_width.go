@@ -0,0 +1,347 @@
+package xsv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrNoWidthTags = errors.New("no width struct tags found")
+	ErrTruncated   = errors.New("value longer than its column")
+)
+
+// WidthUnit tells how the widths of the columns of fixed-width files are measured
+type WidthUnit int
+
+const (
+	WidthBytes WidthUnit = iota // widths count bytes
+	WidthCells                  // widths count display cells: East Asian wide characters take 2 cells and combining marks none
+)
+
+// fixedLayout is the geometry of a column in fixed-width files, set by the width, align and pad tags of its field
+type fixedLayout struct {
+	width      int // 0 when the width tag is not a positive number
+	alignRight bool
+	pad        rune
+}
+
+func newFixedLayout(width, align, pad string) *fixedLayout {
+	layout := &fixedLayout{pad: ' '}
+	if n, err := strconv.Atoi(width); err == nil && n > 0 {
+		layout.width = n
+	}
+	layout.alignRight = align == "right"
+	if r, size := utf8.DecodeRuneInString(pad); size > 0 && size == len(pad) {
+		layout.pad = r
+	}
+	return layout
+}
+
+// unpadded removes the padding of a cell read from a fixed-width file, keeping the sign of numbers padded with '0'
+func (l *fixedLayout) unpadded(cell string) string {
+	if !l.alignRight {
+		return strings.TrimRight(cell, string(l.pad))
+	}
+	sign := ""
+	if l.pad == '0' && cell != "" && (cell[0] == '-' || cell[0] == '+') {
+		sign, cell = cell[:1], cell[1:]
+	}
+	trimmed := strings.TrimLeft(cell, string(l.pad))
+	if trimmed == "" && l.pad == '0' && cell != "" {
+		trimmed = "0"
+	}
+	return sign + trimmed
+}
+
+// padded pads or truncates a cell to the width of the column, the padding goes after the sign of numbers padded with '0'.
+// It fails with ErrTruncated instead of truncating when failIfTruncated is set.
+func (l *fixedLayout) padded(cell string, unit WidthUnit, failIfTruncated bool) (string, error) {
+	head, tail := cutWidth(cell, l.width, unit)
+	if tail != "" {
+		if failIfTruncated {
+			return "", ErrTruncated
+		}
+		if unit == WidthBytes {
+			// do not cut a character in two
+			for len(head) > 0 && !utf8.RuneStart(tail[0]) {
+				head, tail = head[:len(head)-1], head[len(head)-1:]+tail
+			}
+		}
+		cell = head
+	}
+	missing := l.width - measureWidth(cell, unit)
+	pad := string(l.pad)
+	padWidth := measureWidth(pad, unit)
+	if padWidth == 0 {
+		pad, padWidth = " ", 1
+	}
+	padding := strings.Repeat(pad, missing/padWidth) + strings.Repeat(" ", missing%padWidth)
+	switch {
+	case !l.alignRight:
+		return cell + padding, nil
+	case l.pad == '0' && cell != "" && (cell[0] == '-' || cell[0] == '+'):
+		return cell[:1] + padding + cell[1:], nil
+	default:
+		return padding + cell, nil
+	}
+}
+
+// cutWidth splits s after width bytes or display cells
+func cutWidth(s string, width int, unit WidthUnit) (head, tail string) {
+	if unit == WidthBytes {
+		if len(s) <= width {
+			return s, ""
+		}
+		return s[:width], s[width:]
+	}
+	cells := 0
+	for i, r := range s {
+		cells += runeCells(r)
+		if cells > width {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+// measureWidth returns the width of s in bytes or display cells
+func measureWidth(s string, unit WidthUnit) int {
+	if unit == WidthBytes {
+		return len(s)
+	}
+	cells := 0
+	for _, r := range s {
+		cells += runeCells(r)
+	}
+	return cells
+}
+
+// FixedWidth manages configuration values related to fixed-width files.
+// Their columns are the struct fields with a width tag, in the order of the struct, e.g. `csv:"amount" width:"12" align:"right" pad:"0"`.
+type FixedWidth[T any] struct {
+	TagName         string       // key in the struct field's tag to scan
+	TagSeparator    string       // separator string for multiple csv tags in struct fields
+	WidthUnit       WidthUnit    // how the widths are measured, WidthBytes or WidthCells
+	UseCRLF         bool         // on write, lines end with \r\n instead of \n
+	FailIfTruncated bool         // on write, values longer than their column are an error instead of being truncated
+	OnRecord        func(T) T    // callback function to be called on each record
+	ErrorHandler    ErrorHandler // called on the cells that cannot be decoded, see XsvRead.ErrorHandler
+	MaxErrors       int          // see XsvRead.MaxErrors
+	nameNormalizer  Normalizer
+}
+
+// NewFixedWidth creates a new FixedWidth struct with default configuration values
+func NewFixedWidth[T any]() *FixedWidth[T] {
+	return &FixedWidth[T]{
+		TagName:         "csv",
+		TagSeparator:    ",",
+		WidthUnit:       WidthBytes,
+		UseCRLF:         false,
+		FailIfTruncated: false,
+		OnRecord:        nil,
+		ErrorHandler:    nil,
+		MaxErrors:       0,
+		nameNormalizer:  func(s string) string { return s },
+	}
+}
+
+// fixedColumns returns the fields of T with a width tag, in order
+func (f *FixedWidth[T]) fixedColumns() (columns []*fieldInfo, innerWasPointer bool, innerType reflect.Type, err error) {
+	innerWasPointer, innerType = getConcreteContainerInnerType(reflect.TypeOf([]T(nil)))
+	if err := ensureOutInnerType(innerType); err != nil {
+		return nil, false, nil, err
+	}
+	structInfo := getDecodePlan(innerType, f.TagName, f.TagSeparator, f.nameNormalizer).structInfo
+	for i := range structInfo.Fields {
+		field := &structInfo.Fields[i]
+		if field.fixed == nil {
+			continue
+		}
+		if field.fixed.width == 0 {
+			return nil, false, nil, fmt.Errorf("invalid width of column %q", field.getFirstKey())
+		}
+		columns = append(columns, field)
+	}
+	if len(columns) == 0 {
+		return nil, false, nil, ErrNoWidthTags
+	}
+	return columns, innerWasPointer, innerType, nil
+}
+
+func (f *FixedWidth[T]) SetReader(r io.Reader) *FixedWidthReader[T] {
+	return &FixedWidthReader[T]{FixedWidth: *f, reader: bufio.NewReader(r)}
+}
+
+func (f *FixedWidth[T]) SetWriter(w io.Writer) *FixedWidthWriter[T] {
+	return &FixedWidthWriter[T]{FixedWidth: *f, writer: bufio.NewWriter(w)}
+}
+
+// FixedWidthReader reads the records of a fixed-width file, one per line, skipping the empty lines.
+// Lines shorter than the columns leave the last fields empty and the characters after the last column are ignored.
+type FixedWidthReader[T any] struct {
+	FixedWidth[T]
+	reader  *bufio.Reader
+	columns []*fieldInfo
+	decoder *recordDecoder // created on the first call to Next
+	record  []string
+	line    int
+	value   T
+	err     error
+	done    bool
+}
+
+// Next reads and decodes the next record, see XsvReader.Next
+func (r *FixedWidthReader[T]) Next() bool {
+	if r.err != nil || r.done {
+		return false
+	}
+	if r.decoder == nil {
+		columns, innerWasPointer, innerType, err := r.fixedColumns()
+		if err != nil {
+			r.err = err
+			return false
+		}
+		r.columns = columns
+		r.decoder = newRecordDecoder(nil, columns, innerWasPointer, innerType, r.ErrorHandler, r.MaxErrors)
+	}
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			r.err = err
+			return false
+		}
+		if line == "" && err == io.EOF {
+			r.done = true
+			r.err = r.decoder.collected()
+			return false
+		}
+		r.line++
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			continue
+		}
+
+		r.record = r.record[:0]
+		for _, column := range r.columns {
+			var cell string
+			cell, line = cutWidth(line, column.fixed.width, r.WidthUnit)
+			r.record = append(r.record, column.fixed.unpadded(cell))
+		}
+		outInner, cellErrs := r.decoder.decode(r.record, r.line)
+		if r.err = r.decoder.handle(cellErrs); r.err != nil {
+			return false
+		}
+		value := outInner.Interface().(T)
+		if r.OnRecord != nil {
+			value = r.OnRecord(value)
+		}
+		r.value = value
+		return true
+	}
+}
+
+// Value returns the record read by the last call to Next
+func (r *FixedWidthReader[T]) Value() T {
+	return r.value
+}
+
+// Err returns the error that stopped Next, nil at the end of the file
+func (r *FixedWidthReader[T]) Err() error {
+	return r.err
+}
+
+// ReadTo reads all the records into out, it returns ErrEmptyCSVFile when there is none
+func (r *FixedWidthReader[T]) ReadTo(out *[]T) error {
+	rows := *out
+	i := 0
+	for ; r.Next(); i++ {
+		if i < len(rows) {
+			rows[i] = r.Value()
+		} else {
+			rows = append(rows, r.Value())
+		}
+	}
+	*out = rows
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if i == 0 {
+		return ErrEmptyCSVFile
+	}
+	return nil
+}
+
+// ReadEach sends each record to c and closes c once the file has been read
+func (r *FixedWidthReader[T]) ReadEach(c chan T) error {
+	defer close(c)
+	for r.Next() {
+		c <- r.Value()
+	}
+	return r.Err()
+}
+
+// FixedWidthWriter writes records as lines of fixed-width columns, padded or truncated to the width of the columns
+type FixedWidthWriter[T any] struct {
+	FixedWidth[T]
+	writer            *bufio.Writer
+	columns           []*fieldInfo // computed from T by the first call to WriteRow
+	inInnerWasPointer bool
+}
+
+// WriteRow writes one record, records are buffered until Flush is called
+func (w *FixedWidthWriter[T]) WriteRow(v T) error {
+	if w.columns == nil {
+		columns, inInnerWasPointer, _, err := w.fixedColumns()
+		if err != nil {
+			return err
+		}
+		w.columns, w.inInnerWasPointer = columns, inInnerWasPointer
+	}
+	if w.OnRecord != nil {
+		v = w.OnRecord(v)
+	}
+	inValue := addressable(reflect.ValueOf(v))
+	for _, column := range w.columns {
+		cell, err := getInnerField(inValue, w.inInnerWasPointer, column.IndexChain, column.format)
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(cell, "\r\n") {
+			return fmt.Errorf("column %q: cannot write a line break in a fixed-width file", column.getFirstKey())
+		}
+		if cell, err = column.fixed.padded(cell, w.WidthUnit, w.FailIfTruncated); err != nil {
+			return fmt.Errorf("column %q: %w", column.getFirstKey(), err)
+		}
+		if _, err := w.writer.WriteString(cell); err != nil {
+			return err
+		}
+	}
+	lineBreak := "\n"
+	if w.UseCRLF {
+		lineBreak = "\r\n"
+	}
+	_, err := w.writer.WriteString(lineBreak)
+	return err
+}
+
+// Write writes data, then flushes the writer
+func (w *FixedWidthWriter[T]) Write(data []T) error {
+	for _, v := range data {
+		if err := w.WriteRow(v); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Flush writes the buffered records to the underlying writer
+func (w *FixedWidthWriter[T]) Flush() error {
+	return w.writer.Flush()
+}
@@ -0,0 +1,90 @@
+package xsv
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_fixedWidth(t *testing.T) {
+	s := []FixedWidthSample{
+		{ID: "A1", Name: "John", Amount: 1250, Rate: 1.5, Ignored: "x"},
+		{ID: "B2", Name: "Jacqueline Smith", Amount: -42, Rate: 12.25},
+	}
+	b := bytes.Buffer{}
+	if err := NewFixedWidth[FixedWidthSample]().SetWriter(&b).Write(s); err != nil {
+		t.Fatal(err)
+	}
+	expected := "A1  John      00001250  1.50\n" +
+		"B2  Jacqueline-0000042 12.25\n"
+	if b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+
+	var out []FixedWidthSample
+	if err := NewFixedWidth[FixedWidthSample]().SetReader(strings.NewReader(b.String() + "\nC3\n")).ReadTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(out))
+	}
+	if out[0] != (FixedWidthSample{ID: "A1", Name: "John", Amount: 1250, Rate: 1.5}) {
+		t.Fatalf("expected the first record, got %+v", out[0])
+	}
+	if out[1] != (FixedWidthSample{ID: "B2", Name: "Jacqueline", Amount: -42, Rate: 12.25}) {
+		t.Fatalf("expected the truncated second record, got %+v", out[1])
+	}
+	if out[2] != (FixedWidthSample{ID: "C3"}) {
+		t.Fatalf("expected a short line to leave the last fields empty, got %+v", out[2])
+	}
+
+	strict := NewFixedWidth[FixedWidthSample]()
+	strict.FailIfTruncated = true
+	if err := strict.SetWriter(&b).Write(s); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+
+	err := NewFixedWidth[FixedWidthSample]().SetReader(strings.NewReader("A1  John      0000x250  1.50\n")).ReadTo(&out)
+	if err == nil || !strings.Contains(err.Error(), "line 1, column 3") {
+		t.Fatalf("expected an error on line 1, column 3, got %v", err)
+	}
+	if err := NewFixedWidth[Sample]().SetReader(strings.NewReader("x\n")).ReadTo(&[]Sample{}); !errors.Is(err, ErrNoWidthTags) {
+		t.Fatalf("expected ErrNoWidthTags, got %v", err)
+	}
+}
+
+func Test_fixedWidth_cells(t *testing.T) {
+	type Item struct {
+		Name  string `csv:"name" width:"6"`
+		Price int    `csv:"price" width:"5" align:"right"`
+	}
+	items := []Item{{Name: "東京都", Price: 100}, {Name: "é漢字x", Price: 7}, {Name: "ｱｲｳｴｵカ", Price: 1}}
+	b := bytes.Buffer{}
+	cells := NewFixedWidth[Item]()
+	cells.WidthUnit = WidthCells
+	if err := cells.SetWriter(&b).Write(items); err != nil {
+		t.Fatal(err)
+	}
+	expected := "東京都  100\n" +
+		"é漢字x    7\n" +
+		"ｱｲｳｴｵ     1\n"
+	if b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+	var out []Item
+	if err := cells.SetReader(&b).ReadTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 || out[0] != items[0] || out[1] != items[1] || out[2] != (Item{Name: "ｱｲｳｴｵ", Price: 1}) {
+		t.Fatalf("expected the items back with the last name truncated to 6 cells, got %+v", out)
+	}
+
+	b.Reset()
+	if err := NewFixedWidth[Item]().SetWriter(&b).Write(items[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "東京  100\n" {
+		t.Fatalf("expected a truncation on a character boundary, got %q", b.String())
+	}
+}
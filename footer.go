@@ -0,0 +1,208 @@
+package xsv
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FooterKind tells how the cell of a column is computed in the footer row
+type FooterKind int
+
+const (
+	FooterNone   FooterKind = iota // empty cell
+	FooterSum                      // sum of the numbers of the column
+	FooterCount                    // number of non-empty cells of the column
+	FooterMin                      // smallest number of the column
+	FooterMax                      // largest number of the column
+	FooterAvg                      // average of the numbers of the column, rounded to two more decimals than them
+	FooterLabel                    // Footer.Label
+	FooterReduce                   // Footer.Reduce
+)
+
+// Footer describes the cell of a column in the footer row written after the last record.
+// Sum, min, max and avg ignore the empty cells and fail on the cells that are not numbers.
+type Footer[T any] struct {
+	Kind   FooterKind
+	Label  string                                       // text of the cell with FooterLabel
+	Reduce func(state string, record T) (string, error) // called for each record with FooterReduce, state starts empty and the final state is the cell
+}
+
+// footerAccumulator computes the footer cell of a column while the records are written
+type footerAccumulator[T any] struct {
+	Footer[T]
+	column   string
+	kind     reflect.Kind // kind of the field of the column, integers are added as integers so that they keep all their digits
+	count    int
+	decimals int // most digits after the decimal point of the numbers, 0 for integers and -1 when a float is in exponent notation
+	floats   numberTotals[float64]
+	ints     numberTotals[int64]
+	uints    numberTotals[uint64]
+	state    string
+}
+
+func newFooterAccumulator[T any](footer Footer[T], column string, kind reflect.Kind) *footerAccumulator[T] {
+	return &footerAccumulator[T]{Footer: footer, column: column, kind: kind}
+}
+
+// numberTotals holds the sum, the smallest and the largest of the numbers of a column
+type numberTotals[N int64 | uint64 | float64] struct {
+	total, min, max N
+}
+
+// add adds n to the totals, first telling whether it is the first number, and returns false when the sum overflows
+func (t *numberTotals[N]) add(n N, first bool) bool {
+	if first {
+		t.min, t.max = n, n
+	} else {
+		t.min, t.max = min(t.min, n), max(t.max, n)
+	}
+	sum := t.total + n
+	if (n > 0 && sum < t.total) || (n < 0 && sum > t.total) {
+		return false
+	}
+	t.total = sum
+	return true
+}
+
+// get returns the total written by the footer kind
+func (t *numberTotals[N]) get(kind FooterKind) N {
+	switch kind {
+	case FooterMin:
+		return t.min
+	case FooterMax:
+		return t.max
+	}
+	return t.total
+}
+
+// needsNumbers tells whether add needs the value of the cell as a number
+func (a *footerAccumulator[T]) needsNumbers() bool {
+	switch a.Kind {
+	case FooterSum, FooterMin, FooterMax, FooterAvg:
+		return true
+	}
+	return false
+}
+
+// add accumulates a record and the unformatted value of its cell in the column
+func (a *footerAccumulator[T]) add(record T, value string) (err error) {
+	switch a.Kind {
+	case FooterReduce:
+		a.state, err = a.Reduce(a.state, record)
+		return err
+	case FooterCount:
+		if value != "" {
+			a.count++
+		}
+		return nil
+	}
+	if !a.needsNumbers() || value == "" {
+		return nil
+	}
+	first, added := a.count == 0, true
+	switch a.kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(value, 10, 64); err == nil {
+			added = a.ints.add(i, first)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		if u, err = strconv.ParseUint(value, 10, 64); err == nil {
+			added = a.uints.add(u, first)
+		}
+	default:
+		var f float64
+		if f, err = strconv.ParseFloat(value, 64); err == nil {
+			a.floats.add(f, first)
+			if decimals := decimalsOf(value); decimals < 0 || a.decimals < 0 {
+				a.decimals = -1
+			} else {
+				a.decimals = max(a.decimals, decimals)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot compute the footer of column %s: %w", a.column, err)
+	}
+	if !added && (a.Kind == FooterSum || a.Kind == FooterAvg) {
+		return fmt.Errorf("cannot compute the footer of column %s: the sum overflows %s", a.column, a.kind)
+	}
+	a.count++
+	return nil
+}
+
+// decimalsOf returns the number of digits after the decimal point of a number, -1 for the exponent notation, NaN and Inf
+func decimalsOf(value string) int {
+	if strings.ContainsAny(value, "eEnN") {
+		return -1
+	}
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		return len(value) - i - 1
+	}
+	return 0
+}
+
+// result returns the footer cell, formatted with the format directives of the column
+func (a *footerAccumulator[T]) result(format *fieldFormat) (string, error) {
+	switch a.Kind {
+	case FooterLabel:
+		return a.Label, nil
+	case FooterReduce:
+		return a.state, nil
+	case FooterCount:
+		return strconv.Itoa(a.count), nil
+	case FooterSum, FooterMin, FooterMax, FooterAvg:
+		if a.count == 0 && a.Kind != FooterSum {
+			return "", nil
+		}
+	default:
+		return "", nil
+	}
+
+	var number any
+	switch a.kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number = a.ints.get(a.Kind)
+		if a.Kind == FooterAvg {
+			number = a.average(float64(a.ints.total))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number = a.uints.get(a.Kind)
+		if a.Kind == FooterAvg {
+			number = a.average(float64(a.uints.total))
+		}
+	default:
+		number = roundTo(a.floats.get(a.Kind), a.decimals) // the sum of the numbers cannot have more decimals than them, the other digits are rounding noise
+		if a.Kind == FooterAvg {
+			number = a.average(a.floats.total)
+		}
+	}
+	return a.formatNumber(reflect.ValueOf(number), format)
+}
+
+// average returns the average of the numbers of the column, rounded to two more decimals than them
+func (a *footerAccumulator[T]) average(total float64) float64 {
+	if a.decimals < 0 {
+		return total / float64(a.count)
+	}
+	return roundTo(total/float64(a.count), a.decimals+2)
+}
+
+// roundTo rounds f to the number of digits after the decimal point, f is left as it is when decimals is negative
+func roundTo(f float64, decimals int) float64 {
+	if decimals < 0 {
+		return f
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'f', decimals, 64), 64)
+	return rounded
+}
+
+func (a *footerAccumulator[T]) formatNumber(number reflect.Value, format *fieldFormat) (string, error) {
+	if format == nil {
+		return getFieldAsString(number)
+	}
+	return format.format(number)
+}
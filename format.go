@@ -0,0 +1,172 @@
+package xsv
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fieldFormat holds the format directives of a field tag: format=, precision=, true=, false= and pad=.
+// The writer formats the field with them and the reader parses the cells back before converting them.
+type fieldFormat struct {
+	verb       string // fmt verb, with optional literal text around it such as "$%.2f"
+	precision  int    // digits after the decimal point of floats, -1 when not set
+	trueValue  string
+	falseValue string
+	pad        rune // cells are left padded with pad up to width characters, the values other than numbers cannot start with it
+	width      int
+}
+
+func newFieldFormat() *fieldFormat {
+	return &fieldFormat{precision: -1}
+}
+
+func isFormatDirective(name string) bool {
+	switch name {
+	case "format", "precision", "true", "false", "pad":
+		return true
+	}
+	return false
+}
+
+// setDirective applies a name=value format directive of a tag to f
+func (f *fieldFormat) setDirective(name, value string) {
+	switch name {
+	case "format":
+		f.verb = value
+	case "precision":
+		if precision, err := strconv.Atoi(value); err == nil && precision >= 0 {
+			f.precision = precision
+		}
+	case "true":
+		f.trueValue = value
+	case "false":
+		f.falseValue = value
+	case "pad": // pad=0:8, the character may be a colon too
+		if i := strings.LastIndex(value, ":"); i > 0 {
+			if width, err := strconv.Atoi(value[i+1:]); err == nil {
+				f.pad, _ = utf8.DecodeRuneInString(value[:i])
+				f.width = width
+			}
+		}
+	}
+}
+
+// format returns the string representation of field with the format directives
+func (f *fieldFormat) format(field reflect.Value) (string, error) {
+	for field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+		if field.IsNil() {
+			return "", nil
+		}
+		field = field.Elem()
+	}
+
+	var str string
+	var err error
+	switch kind := field.Kind(); {
+	case kind == reflect.Bool && (f.trueValue != "" || f.falseValue != ""):
+		str = f.falseValue
+		if field.Bool() {
+			str = f.trueValue
+		}
+	case f.verb != "" && kind >= reflect.Int && kind <= reflect.Int64:
+		str = fmt.Sprintf(f.verb, field.Int())
+	case f.verb != "" && kind >= reflect.Uint && kind <= reflect.Uint64:
+		str = fmt.Sprintf(f.verb, field.Uint())
+	case f.verb != "" && (kind == reflect.Float32 || kind == reflect.Float64):
+		str = fmt.Sprintf(f.verb, field.Float())
+	case f.precision >= 0 && (kind == reflect.Float32 || kind == reflect.Float64):
+		str = strconv.FormatFloat(field.Float(), 'f', f.precision, field.Type().Bits())
+	default:
+		str, err = getFieldAsString(field)
+		if err == nil && f.verb != "" {
+			str = fmt.Sprintf(f.verb, str)
+		}
+	}
+	if err != nil || f.width <= 0 {
+		return str, err
+	}
+	number := isNumberKind(field.Kind())
+	if !number && strings.HasPrefix(str, string(f.pad)) {
+		// the reader would take its leading pad characters for padding
+		return "", fmt.Errorf("cannot pad %q, which starts with the pad character %q", str, f.pad)
+	}
+	return f.padded(str, number), nil
+}
+
+// parse reverts the format directives on a cell before it is converted to a field of the given kind
+func (f *fieldFormat) parse(value string, kind reflect.Kind) string {
+	if value == "" {
+		return value
+	}
+	if f.width > 0 {
+		value = f.unpadded(value, isNumberKind(kind))
+	}
+	if f.verb != "" {
+		prefix, suffix := f.literals()
+		value = strings.TrimSuffix(strings.TrimPrefix(value, prefix), suffix)
+	}
+	if kind == reflect.Bool {
+		if f.trueValue != "" && value == f.trueValue {
+			return "true"
+		}
+		if f.falseValue != "" && value == f.falseValue {
+			return "false"
+		}
+	}
+	return value
+}
+
+// isNumberKind tells whether kind is an integer or a float kind
+func isNumberKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64 && kind != reflect.Uintptr
+}
+
+// padded left pads str up to the width, after the sign of numbers when padding with zeros
+func (f *fieldFormat) padded(str string, number bool) string {
+	missing := f.width - utf8.RuneCountInString(str)
+	if missing <= 0 {
+		return str
+	}
+	padding := strings.Repeat(string(f.pad), missing)
+	if number && f.pad == '0' && str != "" && (str[0] == '-' || str[0] == '+') {
+		return str[:1] + padding + str[1:]
+	}
+	return padding + str
+}
+
+// unpadded removes the leading pad characters, which do not start the values written by padded
+func (f *fieldFormat) unpadded(value string, number bool) string {
+	if !number {
+		return strings.TrimLeft(value, string(f.pad))
+	}
+	sign := ""
+	if f.pad == '0' && (value[0] == '-' || value[0] == '+') {
+		sign, value = value[:1], value[1:]
+	}
+	trimmed := strings.TrimLeft(value, string(f.pad))
+	if trimmed == "" && f.pad == '0' && value != "" {
+		trimmed = "0"
+	}
+	return sign + trimmed
+}
+
+// literals returns the text written before and after the value by the fmt verb
+func (f *fieldFormat) literals() (prefix, suffix string) {
+	start := strings.Index(f.verb, "%")
+	if start < 0 {
+		return f.verb, ""
+	}
+	end := start + 1
+	for end < len(f.verb) {
+		r, size := utf8.DecodeRuneInString(f.verb[end:])
+		end += size
+		if unicode.IsLetter(r) {
+			break
+		}
+	}
+	return f.verb[:start], f.verb[end:]
+}
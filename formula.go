@@ -0,0 +1,58 @@
+package xsv
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FormulaProtection tells how XsvWriter neutralises the cells a spreadsheet would run as a formula,
+// the ones starting with '=', '+', '-', '@', a tab or a carriage return
+type FormulaProtection int
+
+const (
+	FormulaAllow  FormulaProtection = iota // write the cells as they are
+	FormulaPrefix                          // prefix the cells with a single quote: '=1+2
+	FormulaWrap                            // wrap the cells in a string formula: ="=1+2"
+)
+
+const formulaTriggers = "=+-@\t\r"
+
+// isFormula tells whether a spreadsheet could interpret a cell as a formula. Numbers, such as negative ones, are not.
+func isFormula(value string) bool {
+	if value == "" || !strings.ContainsRune(formulaTriggers, rune(value[0])) {
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err != nil
+}
+
+// needsProtection tells whether protectFormula changes a cell: when a spreadsheet could run it as a formula,
+// or when it already looks protected, so that stripFormulaProtection gives back every written value as it was
+func needsProtection(value string) bool {
+	return isFormula(value) || stripFormulaProtection(value) != value
+}
+
+// protectFormula neutralises a cell that could be interpreted as a formula
+func protectFormula(value string, protection FormulaProtection) string {
+	if protection == FormulaAllow || !needsProtection(value) {
+		return value
+	}
+	if protection == FormulaWrap {
+		return `="` + strings.ReplaceAll(value, `"`, `""`) + `"`
+	}
+	return "'" + value
+}
+
+// stripFormulaProtection reverts protectFormula, whichever protection was used.
+// It removes one level of protection, and only from the cells protectFormula would have written that way.
+func stripFormulaProtection(value string) string {
+	if strings.HasPrefix(value, "'") && needsProtection(value[1:]) {
+		return value[1:]
+	}
+	if strings.HasPrefix(value, `="`) && strings.HasSuffix(value, `"`) && len(value) >= 3 {
+		if unwrapped := strings.ReplaceAll(value[2:len(value)-1], `""`, `"`); needsProtection(unwrapped) {
+			return unwrapped
+		}
+	}
+	return value
+}
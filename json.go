@@ -0,0 +1,450 @@
+package xsv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONFormat tells how XsvReader.ToJSON writes the records
+type JSONFormat int
+
+const (
+	JSONLines JSONFormat = iota // one object per line, also known as NDJSON
+	JSONArray                   // a single array of objects
+)
+
+var jsonMarshalerType = reflect.TypeOf(new(json.Marshaler)).Elem()
+
+// ToJSON reads the records and writes them to w as JSON objects keyed by the names of the columns in the header of the file,
+// after NameNormalizer, or by the first key of the struct tags of the fields when reading without headers.
+// The values are typed after the struct fields, nil pointers and the missing elements of slices are null,
+// and the dotted columns are nested: addr.city becomes {"addr":{"city":...}} and items[0].sku {"items":[{"sku":...}]}.
+func (r *XsvReader[T]) ToJSON(w io.Writer, format JSONFormat) error {
+	out := bufio.NewWriter(w)
+	if format == JSONArray {
+		if err := out.WriteByte('['); err != nil {
+			return err
+		}
+	}
+	n := 0
+	for ; r.Next(); n++ {
+		object, err := r.jsonObject(r.Value())
+		if err != nil {
+			return err
+		}
+		if format == JSONArray && n > 0 {
+			object = append([]byte{','}, object...)
+		} else if format == JSONLines {
+			object = append(object, '\n')
+		}
+		if _, err := out.Write(object); err != nil {
+			return err
+		}
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if format == JSONArray {
+		if _, err := out.WriteString("]\n"); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// jsonObject encodes the fields of v bound to the columns of the file as a JSON object
+func (r *XsvReader[T]) jsonObject(v T) ([]byte, error) {
+	inValue := addressable(reflect.ValueOf(v))
+	if r.decoder.outInnerWasPointer {
+		if inValue.IsNil() {
+			return []byte("null"), nil
+		}
+		inValue = inValue.Elem()
+	}
+	root := &jsonNode{}
+	for j, fieldInfo := range r.decoder.fields {
+		if fieldInfo == nil {
+			continue
+		}
+		value, err := jsonFieldValue(inValue, fieldInfo.IndexChain)
+		if err != nil {
+			return nil, err
+		}
+		name := fieldInfo.getFirstKey()
+		if j < len(r.decoder.headers) {
+			name = r.decoder.headers[j] // the name the file uses among the keys of the field
+		}
+		if err := root.set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	return root.appendTo(nil), nil
+}
+
+// jsonFieldValue returns the JSON encoding of the field of outInner at index: a number, a bool or an array for the
+// fields of those types, a string for the fields marshalled to csv by a method, null for nil pointers
+func jsonFieldValue(outInner reflect.Value, index []int) (json.RawMessage, error) {
+	field := outInner
+	for _, i := range index {
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return json.RawMessage("null"), nil
+			}
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Slice || field.Kind() == reflect.Array {
+			if i >= field.Len() {
+				return json.RawMessage("null"), nil
+			}
+			field = field.Index(i)
+		} else {
+			field = field.Field(i)
+		}
+	}
+	for field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+		if field.IsNil() {
+			return json.RawMessage("null"), nil
+		}
+		field = field.Elem()
+	}
+
+	if !field.Type().Implements(jsonMarshalerType) && canMarshal(field.Type()) {
+		str, err := getFieldAsString(field)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(str)
+	}
+	if field.CanAddr() {
+		return json.Marshal(field.Addr().Interface())
+	}
+	return json.Marshal(field.Interface())
+}
+
+// jsonNode is a JSON value built from dotted column names, which keeps the order of the columns
+type jsonNode struct {
+	value    json.RawMessage // value of a leaf, nil for objects and arrays
+	names    []string        // member names of an object, in order
+	members  map[string]*jsonNode
+	elements []*jsonNode // elements of an array, nil elements are null
+	isArray  bool
+}
+
+// set sets the value at a column path such as addr.city or items[0].sku, creating the objects and arrays on the way
+func (n *jsonNode) set(path string, value json.RawMessage) error {
+	node := n
+	for _, part := range strings.Split(path, ".") {
+		name, indexes := splitIndexes(part)
+		if node.value != nil || node.isArray {
+			return fmt.Errorf("cannot nest column %q in a value", path)
+		}
+		node = node.member(name)
+		for _, i := range indexes {
+			if node.value != nil || node.members != nil {
+				return fmt.Errorf("cannot nest column %q in a value", path)
+			}
+			node = node.element(i)
+		}
+	}
+	if node.members != nil || node.isArray {
+		return fmt.Errorf("cannot set column %q holding nested columns", path)
+	}
+	node.value = value
+	return nil
+}
+
+func (n *jsonNode) member(name string) *jsonNode {
+	if n.members == nil {
+		n.members = map[string]*jsonNode{}
+	}
+	member, ok := n.members[name]
+	if !ok {
+		member = &jsonNode{}
+		n.members[name] = member
+		n.names = append(n.names, name)
+	}
+	return member
+}
+
+func (n *jsonNode) element(i int) *jsonNode {
+	n.isArray = true
+	for len(n.elements) <= i {
+		n.elements = append(n.elements, nil)
+	}
+	if n.elements[i] == nil {
+		n.elements[i] = &jsonNode{}
+	}
+	return n.elements[i]
+}
+
+func (n *jsonNode) appendTo(b []byte) []byte {
+	switch {
+	case n == nil:
+		return append(b, "null"...)
+	case n.value != nil:
+		return append(b, n.value...)
+	case n.isArray:
+		b = append(b, '[')
+		for i, element := range n.elements {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = element.appendTo(b)
+		}
+		return append(b, ']')
+	default:
+		b = append(b, '{')
+		for i, name := range n.names {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			key, _ := json.Marshal(name)
+			b = append(append(b, key...), ':')
+			b = n.members[name].appendTo(b)
+		}
+		return append(b, '}')
+	}
+}
+
+// splitIndexes splits a part of a column path such as items[0] into its name and its indexes
+func splitIndexes(part string) (string, []int) {
+	name, rest, ok := strings.Cut(part, "[")
+	if !ok {
+		return part, nil
+	}
+	var indexes []int
+	rest = "[" + rest
+	for rest != "" {
+		index, after, ok := strings.Cut(rest[1:], "]")
+		i, err := strconv.Atoi(index)
+		if rest[0] != '[' || !ok || err != nil || i < 0 {
+			return part, nil
+		}
+		indexes = append(indexes, i)
+		rest = after
+	}
+	return name, indexes
+}
+
+// WriteFromJSON reads JSON Lines, or a JSON array, of objects from r and writes them as records, then flushes the writer.
+// The objects are flattened like the struct fields into columns: {"addr":{"city":...}} is the column addr.city and
+// {"items":[{"sku":...}]} the column items[0].sku, unless the struct has a column for the whole object or array.
+// When T is a map or an OrderedRow every value is a column, otherwise the members without a column are ignored.
+// The records are written as they are read, so MapHeaderUnion and ExpandSlices cannot be used.
+func (xw *XsvWriter[T]) WriteFromJSON(r io.Reader) error {
+	inType := reflect.TypeOf((*T)(nil)).Elem()
+	var columns map[string]*fieldInfo // struct field of each column, nil when T is a map or an OrderedRow
+	var inInnerWasPointer bool
+	var inInnerType reflect.Type
+	if !isDynamicType(inType) {
+		inInnerWasPointer, inInnerType = getConcreteContainerInnerType(reflect.SliceOf(inType))
+		if err := ensureInInnerType(inInnerType); err != nil {
+			return err
+		}
+		columns = map[string]*fieldInfo{}
+		structInfo := getDecodePlan(inInnerType, xw.TagName, xw.TagSeparator, xw.nameNormalizer).structInfo
+		for i := range structInfo.Fields {
+			for _, key := range structInfo.Fields[i].keys {
+				columns[key] = &structInfo.Fields[i]
+			}
+		}
+	}
+
+	in := bufio.NewReader(r)
+	decoder := json.NewDecoder(in)
+	decoder.UseNumber()
+	inArray := false
+	if first, err := peekNonSpace(in); err == nil && first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		inArray = true
+	}
+	for n := 1; ; n++ {
+		var object json.RawMessage
+		if inArray && !decoder.More() {
+			break
+		}
+		if err := decoder.Decode(&object); err == io.EOF && !inArray {
+			break
+		} else if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		if len(object) == 0 || object[0] != '{' {
+			return fmt.Errorf("record %d: expected a JSON object, got %s", n, object)
+		}
+
+		var cells []NamedValue
+		if err := flattenJSON(object, "", columns, &cells); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		var v T
+		if columns != nil {
+			outInner := createNewOutInner(inInnerWasPointer, inInnerType)
+			oi := outInner
+			if inInnerWasPointer {
+				oi = outInner.Elem()
+			}
+			for _, cell := range cells {
+				fieldInfo := columns[cell.Name]
+				value := jsonCell(cell.Value)
+				if value == "" {
+					value = fieldInfo.defaultValue
+				}
+				if err := fieldInfo.setter(oi, value); err != nil {
+					return fmt.Errorf("record %d: column %q: %w", n, cell.Name, err)
+				}
+			}
+			v = outInner.Interface().(T)
+		} else {
+			row, err := dynamicRow(inType, cells)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+			v = row.Interface().(T)
+		}
+		if err := xw.WriteRow(v); err != nil {
+			return err
+		}
+	}
+
+	if !xw.headerWritten {
+		if err := xw.WriteHeader(); err != nil {
+			return err
+		}
+	}
+	if err := xw.WriteFooter(); err != nil {
+		return err
+	}
+	return xw.Flush()
+}
+
+// peekNonSpace returns the first byte of r that is not white space, without consuming it
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// flattenJSON appends to cells the values of a JSON value under their column path, starting with prefix.
+// Objects and arrays are flattened unless columns, when not nil, has a column for them; the values without a column are left out.
+func flattenJSON(value json.RawMessage, prefix string, columns map[string]*fieldInfo, cells *[]NamedValue) error {
+	if _, ok := columns[prefix]; ok && prefix != "" {
+		*cells = append(*cells, NamedValue{Name: prefix, Value: value})
+		return nil
+	}
+	switch value[0] {
+	case '{':
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			var member json.RawMessage
+			if err := decoder.Decode(&member); err != nil {
+				return err
+			}
+			path := key.(string)
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			if err := flattenJSON(member, path, columns, cells); err != nil {
+				return err
+			}
+		}
+	case '[':
+		var elements []json.RawMessage
+		if err := json.Unmarshal(value, &elements); err != nil {
+			return err
+		}
+		for i, element := range elements {
+			if err := flattenJSON(element, fmt.Sprintf("%s[%d]", prefix, i), columns, cells); err != nil {
+				return err
+			}
+		}
+	default:
+		if columns == nil {
+			*cells = append(*cells, NamedValue{Name: prefix, Value: value})
+		}
+	}
+	return nil
+}
+
+// jsonCell returns the content of the csv cell of a JSON value: the text of strings, numbers and bools,
+// nothing for null, and the JSON encoding of objects and arrays
+func jsonCell(value any) string {
+	raw := value.(json.RawMessage)
+	switch raw[0] {
+	case '"':
+		var str string
+		_ = json.Unmarshal(raw, &str)
+		return str
+	case 'n':
+		return ""
+	default:
+		return string(raw)
+	}
+}
+
+// jsonScalar returns the Go value of a JSON string, number, bool or null: a string, a json.Number, a bool or nil
+func jsonScalar(value any) any {
+	raw := value.(json.RawMessage)
+	switch raw[0] {
+	case 'n':
+		return nil
+	case 't', 'f':
+		return raw[0] == 't'
+	case '"':
+		return jsonCell(raw)
+	default:
+		return json.Number(raw)
+	}
+}
+
+// dynamicRow creates a map or an OrderedRow of type t from flattened JSON cells
+func dynamicRow(t reflect.Type, cells []NamedValue) (reflect.Value, error) {
+	if t == orderedRowType {
+		row := make(OrderedRow, len(cells))
+		for i, cell := range cells {
+			row[i] = NamedValue{Name: cell.Name, Value: jsonScalar(cell.Value)}
+		}
+		return reflect.ValueOf(row), nil
+	}
+	row := reflect.MakeMapWithSize(t, len(cells))
+	for _, cell := range cells {
+		var value reflect.Value
+		switch {
+		case t.Elem().Kind() == reflect.Interface:
+			scalar := jsonScalar(cell.Value)
+			if scalar == nil {
+				value = reflect.Zero(t.Elem())
+			} else {
+				value = reflect.ValueOf(scalar)
+			}
+		case t.Elem().Kind() == reflect.String:
+			value = reflect.ValueOf(jsonCell(cell.Value))
+		default:
+			return reflect.Value{}, errors.New("cannot write JSON values to " + t.String())
+		}
+		row.SetMapIndex(reflect.ValueOf(cell.Name).Convert(t.Key()), value.Convert(t.Elem()))
+	}
+	return row, nil
+}
@@ -0,0 +1,125 @@
+package xsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type JSONAddress struct {
+	City string `csv:"city"`
+	Zip  *int   `csv:"zip,omitempty"`
+}
+
+type JSONItem struct {
+	SKU string `csv:"sku"`
+	Qty int    `csv:"qty"`
+}
+
+type JSONSample struct {
+	ID      int         `csv:"id"`
+	Name    string      `csv:"name"`
+	Active  bool        `csv:"active"`
+	Price   float64     `csv:"price,format=%.2f"`
+	Created time.Time   `csv:"created"`
+	Address JSONAddress `csv:"addr"`
+	Items   []JSONItem  `csv:"items" csv[]:"2"`
+	Tags    []string    `csv:"tags"`
+	Ignored string      `csv:"-"`
+}
+
+func Test_toJSON(t *testing.T) {
+	input := `id,name,active,price,created,addr.city,addr.zip,items[0].sku,items[0].qty,items[1].sku,items[1].qty,tags
+1,"Ann ""A""",true,1.50,2024-01-02T03:04:05Z,Paris,75001,a,2,,0,"[""x"",""y""]"
+2,Bob,false,10.00,2024-02-03T00:00:00Z,Lyon,,b,1,c,3,null
+`
+	b := bytes.Buffer{}
+	if err := NewXsvRead[JSONSample]().SetStringReader(input).ToJSON(&b, JSONLines); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"id":1,"name":"Ann \"A\"","active":true,"price":1.5,"created":"2024-01-02T03:04:05Z","addr":{"city":"Paris","zip":75001},"items":[{"sku":"a","qty":2},{"sku":"","qty":0}],"tags":["x","y"]}
+{"id":2,"name":"Bob","active":false,"price":10,"created":"2024-02-03T00:00:00Z","addr":{"city":"Lyon","zip":null},"items":[{"sku":"b","qty":1},{"sku":"c","qty":3}],"tags":null}
+`
+	if b.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, b.String())
+	}
+
+	b.Reset()
+	if err := NewXsvRead[*JSONSample]().SetStringReader("name,id\nAnn,1\nBob,2\n").ToJSON(&b, JSONArray); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != `[{"name":"Ann","id":1},{"name":"Bob","id":2}]`+"\n" {
+		t.Fatalf("expected a JSON array in the column order of the file, got %s", b.String())
+	}
+
+	// the keys are the names used by the file among the keys of the fields
+	type aliased struct {
+		ID   int    `csv:"id,ID"`
+		Name string `csv:"name"`
+	}
+	b.Reset()
+	if err := NewXsvRead[aliased]().SetStringReader("ID,name\n1,Ann\n").ToJSON(&b, JSONLines); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != `{"ID":1,"name":"Ann"}`+"\n" {
+		t.Fatalf("expected the names of the file, got %s", b.String())
+	}
+	aliasedJSON := b.String()
+	b.Reset()
+	aliasedWrite := NewXsvWrite[aliased]()
+	if err := aliasedWrite.SetBufferWriter(&b).WriteFromJSON(strings.NewReader(aliasedJSON)); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "id,name\n1,Ann\n" {
+		t.Fatalf("expected the keys of the file to be matched with the fields, got %q", b.String())
+	}
+
+	// back to csv
+	jsonLines := expected
+	b.Reset()
+	xsvWrite := NewXsvWrite[JSONSample]()
+	if err := xsvWrite.SetBufferWriter(&b).WriteFromJSON(strings.NewReader(jsonLines)); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != input {
+		t.Fatalf("expected %s, got %s", input, b.String())
+	}
+}
+
+func Test_writeFromJSON_orderedRows(t *testing.T) {
+	input := `[
+		{"id": 1, "user": {"name": "Ann", "langs": ["go", "sql"]}, "ok": true, "note": null},
+		{"id": 2, "user": {"name": "Bob"}, "extra": 1.5e3}
+	]`
+	b := bytes.Buffer{}
+	xsvWrite := NewXsvWrite[OrderedRow]()
+	if err := xsvWrite.SetBufferWriter(&b).WriteFromJSON(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	assertLine(t, []string{"id", "user.name", "user.langs[0]", "user.langs[1]", "ok", "note"}, lines[0])
+	assertLine(t, []string{"1", "Ann", "go", "sql", "true", ""}, lines[1])
+	assertLine(t, []string{"2", "Bob", "", "", "", ""}, lines[2])
+
+	b.Reset()
+	mapWrite := NewXsvWrite[map[string]any]()
+	mapWrite.MapColumns = []string{"extra", "id"}
+	if err := mapWrite.SetBufferWriter(&b).WriteFromJSON(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "extra,id\n,1\n1.5e3,2\n" {
+		t.Fatalf("expected the numbers as written in the JSON, got %q", b.String())
+	}
+
+	if err := mapWrite.SetBufferWriter(&b).WriteFromJSON(strings.NewReader(`{"id": 1} 2`)); err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Fatalf("expected an error on record 2, got %v", err)
+	}
+}
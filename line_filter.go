@@ -0,0 +1,129 @@
+package xsv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"regexp"
+	"unicode/utf8"
+)
+
+// lineFilter drops the lines skipped by XsvRead.SkipLines, CommentPrefix and SkipPattern, and the lines before the header
+// located by HeaderMinMatches, before the csv.Reader parses them, so that those lines do not need to be valid csv.
+// The dropped lines are replaced with empty lines, which the csv.Reader ignores while still counting them,
+// so the line numbers it reports stay relative to the original file.
+type lineFilter struct {
+	source        *bufio.Reader
+	reader        *csv.Reader // the csv.Reader parsing the filtered lines, for its delimiter and quoting rules
+	skipLines     int
+	commentPrefix string
+	skipPattern   *regexp.Regexp
+	isHeader      func([]string) bool // lines are dropped until one is a header when not nil
+	line          int                 // number of lines read
+	quoted        bool                // the last line read ended inside a quoted field
+	pending       []byte              // filtered content not read yet
+	err           error               // error of the last read from source
+}
+
+func newLineFilter(source *bufio.Reader, skipLines int, commentPrefix string, skipPattern *regexp.Regexp) *lineFilter {
+	return &lineFilter{
+		source:        source,
+		skipLines:     skipLines,
+		commentPrefix: commentPrefix,
+		skipPattern:   skipPattern,
+	}
+}
+
+func (f *lineFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		var line []byte
+		line, f.err = f.source.ReadBytes('\n')
+		if len(line) > 0 {
+			f.pending = f.filter(line)
+		}
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// filter returns the line to hand to the csv.Reader: the line itself, or only its line break when it is dropped.
+// Lines continuing a quoted field are never dropped, except by SkipLines.
+func (f *lineFilter) filter(line []byte) []byte {
+	f.line++
+	content := bytes.TrimRight(line, "\r\n")
+	lineBreak := line[len(content):]
+	if f.line <= f.skipLines {
+		return lineBreak
+	}
+	if !f.quoted && f.drop(content) {
+		return lineBreak
+	}
+	f.quoted = f.endsInQuotes(content, f.quoted)
+	return line
+}
+
+// drop tells whether a line starting a record is skipped
+func (f *lineFilter) drop(content []byte) bool {
+	if f.commentPrefix != "" && bytes.HasPrefix(content, []byte(f.commentPrefix)) {
+		return true
+	}
+	if f.skipPattern != nil && f.skipPattern.Match(content) {
+		return true
+	}
+	if f.isHeader == nil || len(content) == 0 {
+		return false
+	}
+	// the header is looked for in the lines parsed on their own, a banner with a stray quote is not a header
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = f.reader.Comma
+	reader.Comment = f.reader.Comment
+	reader.LazyQuotes = f.reader.LazyQuotes
+	reader.TrimLeadingSpace = f.reader.TrimLeadingSpace
+	reader.FieldsPerRecord = -1
+	record, err := reader.Read()
+	if err != nil || !f.isHeader(record) {
+		return true
+	}
+	f.isHeader = nil
+	return false
+}
+
+// endsInQuotes tells whether a line ends inside a quoted field, quoted telling whether it starts inside one.
+// It follows the rules of the csv.Reader: a field is quoted when it starts with a quote, and a quote that is not doubled
+// closes it when it is followed by the delimiter or the end of the line, or always without LazyQuotes.
+func (f *lineFilter) endsInQuotes(content []byte, quoted bool) bool {
+	if !quoted && f.reader.Comment != 0 && bytes.HasPrefix(content, utf8.AppendRune(nil, f.reader.Comment)) {
+		return false
+	}
+	delimiter := utf8.AppendRune(nil, f.reader.Comma)
+	fieldStart := !quoted
+	for i := 0; i < len(content); {
+		switch {
+		case quoted:
+			if content[i] == '"' {
+				if i+1 < len(content) && content[i+1] == '"' {
+					i++
+				} else if i+1 == len(content) || bytes.HasPrefix(content[i+1:], delimiter) || !f.reader.LazyQuotes {
+					quoted = false
+				}
+			}
+			i++
+		case fieldStart && f.reader.TrimLeadingSpace && (content[i] == ' ' || content[i] == '\t'):
+			i++
+		case fieldStart && content[i] == '"':
+			quoted, fieldStart = true, false
+			i++
+		case bytes.HasPrefix(content[i:], delimiter):
+			fieldStart = true
+			i += len(delimiter)
+		default:
+			fieldStart = false
+			i++
+		}
+	}
+	return quoted
+}
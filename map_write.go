@@ -0,0 +1,90 @@
+package xsv
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+)
+
+var (
+	ErrNoMapColumns   = errors.New("the columns of maps and ordered rows are not known, set MapColumns or write a row first")
+	ErrMapHeaderUnion = errors.New("MapHeaderUnion needs all the rows at once, use Write")
+)
+
+// OrderedRow is a record of named values written in their order, for schemas only known at run time
+type OrderedRow []NamedValue
+
+// NamedValue is a cell of an OrderedRow
+type NamedValue struct {
+	Name  string
+	Value any
+}
+
+// MapHeader tells where the columns come from when writing maps or ordered rows without MapColumns
+type MapHeader int
+
+const (
+	MapHeaderFirstRow MapHeader = iota // the names of the first row, in order for an OrderedRow and sorted for a map
+	MapHeaderUnion                     // the sorted union of the keys of all the rows given to Write
+)
+
+var orderedRowType = reflect.TypeOf(OrderedRow(nil))
+
+// isDynamicType tells whether the columns of the values of type t come from their keys instead of struct fields
+func isDynamicType(t reflect.Type) bool {
+	return t == orderedRowType || (t.Kind() == reflect.Map && t.Key().Kind() == reflect.String)
+}
+
+// rowColumns returns the names of the cells of a map or an ordered row, sorted for a map
+func rowColumns(row reflect.Value) []string {
+	if row.Type() == orderedRowType {
+		columns := make([]string, 0, row.Len())
+		for _, value := range row.Interface().(OrderedRow) {
+			columns = append(columns, value.Name)
+		}
+		return columns
+	}
+	columns := make([]string, 0, row.Len())
+	for _, key := range row.MapKeys() {
+		columns = append(columns, key.String())
+	}
+	slices.Sort(columns)
+	return columns
+}
+
+// dynamicFieldInfos returns a column for each name, whose cells are the values of the maps or ordered rows under that name
+func dynamicFieldInfos(columns []string) []fieldInfo {
+	fieldInfos := make([]fieldInfo, len(columns))
+	for i, column := range columns {
+		fieldInfos[i] = fieldInfo{
+			keys:     []string{column},
+			position: -1,
+			compute: func(row any) (string, error) {
+				return rowCell(reflect.ValueOf(row), column)
+			},
+		}
+	}
+	return fieldInfos
+}
+
+// rowCell formats the value of row under column with the rules of getFieldAsString, missing values are empty cells
+func rowCell(row reflect.Value, column string) (string, error) {
+	var value reflect.Value
+	if row.Type() == orderedRowType {
+		for _, namedValue := range row.Interface().(OrderedRow) {
+			if namedValue.Name == column {
+				value = reflect.ValueOf(namedValue.Value)
+				break
+			}
+		}
+	} else {
+		value = row.MapIndex(reflect.ValueOf(column).Convert(row.Type().Key()))
+	}
+	for value.IsValid() && value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return "", nil
+	}
+	return getFieldAsString(addressable(value))
+}
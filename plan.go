@@ -0,0 +1,250 @@
+package xsv
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// --------------------------------------------------------------------------
+// Compiled decode plans
+
+// fieldSetter sets the struct field a fieldInfo points to from the string content of a csv cell.
+// The reflect.Value it receives is the (addressable) struct the IndexChain starts from.
+type fieldSetter func(outInner reflect.Value, value string) error
+
+type decodePlanKey struct {
+	outInnerType reflect.Type
+	tagName      string
+	tagSeparator string
+}
+
+// decodePlan is the result of getFieldInfos for a struct type, with a setter compiled for each field
+type decodePlan struct {
+	structInfo *structInfo
+}
+
+var decodePlans sync.Map // decodePlanKey -> map[string]fieldSetter, the setters by indexChainKey of their field
+
+// getDecodePlan returns the decode plan of outInnerType with the keys of its fields normalized by normalizeName.
+// The setters are compiled on the first use and cached. The keys are worked out by getFieldInfos on each call,
+// normalizing each component of the nested keys, since two normalizers cannot be told apart by their function.
+func getDecodePlan(outInnerType reflect.Type, tagName, tagSeparator string, normalizeName Normalizer) *decodePlan {
+	fieldInfos := getFieldInfos(outInnerType, []int{}, []string{}, tagName, tagSeparator, normalizeName)
+	key := decodePlanKey{
+		outInnerType: outInnerType,
+		tagName:      tagName,
+		tagSeparator: tagSeparator,
+	}
+	cached, ok := decodePlans.Load(key)
+	if !ok {
+		setters := make(map[string]fieldSetter, len(fieldInfos))
+		for _, fieldInfo := range fieldInfos {
+			setters[indexChainKey(fieldInfo.IndexChain)] = compileSetter(outInnerType, fieldInfo.IndexChain, fieldInfo.omitEmpty, fieldInfo.format)
+		}
+		cached, _ = decodePlans.LoadOrStore(key, setters)
+	}
+
+	setters := cached.(map[string]fieldSetter)
+	for i := range fieldInfos {
+		fieldInfos[i].setter = setters[indexChainKey(fieldInfos[i].IndexChain)]
+		if fieldInfos[i].setter == nil { // a field the normalizer did not let through when the setters were compiled
+			fieldInfos[i].setter = compileSetter(outInnerType, fieldInfos[i].IndexChain, fieldInfos[i].omitEmpty, fieldInfos[i].format)
+		}
+	}
+	return &decodePlan{structInfo: &structInfo{fieldInfos}}
+}
+
+// compileSetter resolves once everything setInnerField works out for each cell:
+// which struct, slice or pointer to walk through and how to convert the string to the field type.
+func compileSetter(t reflect.Type, index []int, omitEmpty bool, format *fieldFormat) fieldSetter {
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		i := index[0]
+		var next fieldSetter
+		if len(index) > 1 {
+			next = compileSetter(t.Elem(), index[1:], omitEmpty, format)
+		} else {
+			next = compileFormattedConverter(t.Elem(), omitEmpty, format)
+		}
+		if t.Kind() == reflect.Array {
+			return func(oi reflect.Value, value string) error {
+				return next(oi.Index(i), value)
+			}
+		}
+		return func(oi reflect.Value, value string) error {
+			// grow slice when needed
+			if i >= oi.Cap() {
+				newcap := oi.Cap() + oi.Cap()/2
+				if newcap < 4 {
+					newcap = 4
+				}
+				if newcap <= i {
+					newcap = i + 1
+				}
+				newoi := reflect.MakeSlice(oi.Type(), oi.Len(), newcap)
+				reflect.Copy(newoi, oi)
+				oi.Set(newoi)
+			}
+			if i >= oi.Len() {
+				oi.SetLen(i + 1)
+			}
+			return next(oi.Index(i), value)
+		}
+	}
+
+	i := index[0]
+	fieldType := t.Field(i).Type
+	if len(index) == 1 {
+		convert := compileFormattedConverter(fieldType, omitEmpty, format)
+		return func(oi reflect.Value, value string) error {
+			return convert(oi.Field(i), value)
+		}
+	}
+
+	// because pointers can be nil, initialize them before walking to the next index
+	if fieldType.Kind() == reflect.Ptr {
+		next := compileSetter(fieldType.Elem(), index[1:], omitEmpty, format)
+		return func(oi reflect.Value, value string) error {
+			field := oi.Field(i)
+			if field.IsNil() {
+				if err := setField(field, "", omitEmpty); err != nil {
+					return err
+				}
+			}
+			return next(field.Elem(), value)
+		}
+	}
+	next := compileSetter(fieldType, index[1:], omitEmpty, format)
+	return func(oi reflect.Value, value string) error {
+		return next(oi.Field(i), value)
+	}
+}
+
+// compileFormattedConverter returns compileConverter, parsing the cells with the format directives of the field first
+func compileFormattedConverter(t reflect.Type, omitEmpty bool, format *fieldFormat) fieldSetter {
+	convert := compileConverter(t, omitEmpty)
+	if format == nil {
+		return convert
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	kind := t.Kind()
+	return func(field reflect.Value, value string) error {
+		return convert(field, format.parse(value, kind))
+	}
+}
+
+// compileConverter returns the function converting a csv cell to a field of type t, it mirrors setField
+func compileConverter(t reflect.Type, omitEmpty bool) fieldSetter {
+	if t.Kind() == reflect.Ptr {
+		convert := compileConverter(t.Elem(), omitEmpty)
+		skipEmpty := omitEmpty && t.Elem().Kind() != reflect.Struct
+		return func(field reflect.Value, value string) error {
+			if field.IsNil() {
+				if skipEmpty && value == "" {
+					return nil
+				}
+				field.Set(reflect.New(t.Elem()))
+			}
+			return convert(field.Elem(), value)
+		}
+	}
+
+	switch t {
+	case reflect.TypeOf(""):
+		return setString
+	case reflect.TypeOf(false):
+		return setBool
+	}
+	if t.PkgPath() == "" && t.Name() != "" { // go native numeric types
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return setInt
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return setUint
+		case reflect.Float32, reflect.Float64:
+			return setFloat
+		}
+	}
+
+	// Not a native type, check for unmarshal method
+	ptrType := reflect.PtrTo(t)
+	if ptrType.Implements(unmarshalerType) {
+		return func(field reflect.Value, value string) error {
+			return field.Addr().Interface().(TypeUnmarshaller).UnmarshalCSV(value)
+		}
+	}
+	if ptrType.Implements(textUnmarshalerType) {
+		return func(field reflect.Value, value string) error {
+			return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		}
+	}
+
+	// Could not unmarshal, check for kind, e.g. renamed type from basic type
+	switch t.Kind() {
+	case reflect.String:
+		return setString
+	case reflect.Bool:
+		return setBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return setInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return setUint
+	case reflect.Float32, reflect.Float64:
+		return setFloat
+	case reflect.Slice, reflect.Struct:
+		return func(field reflect.Value, value string) error {
+			if value == "" {
+				return nil
+			}
+			return json.Unmarshal([]byte(value), field.Addr().Interface())
+		}
+	}
+	// interfaces and other kinds keep the dynamic behaviour of setField
+	return func(field reflect.Value, value string) error {
+		return setField(field, value, omitEmpty)
+	}
+}
+
+func setString(field reflect.Value, value string) error {
+	field.SetString(value)
+	return nil
+}
+
+func setBool(field reflect.Value, value string) error {
+	b, err := parseBool(value)
+	if err != nil {
+		return err
+	}
+	field.SetBool(b)
+	return nil
+}
+
+func setInt(field reflect.Value, value string) error {
+	i, err := parseInt(value)
+	if err != nil {
+		return err
+	}
+	field.SetInt(i)
+	return nil
+}
+
+func setUint(field reflect.Value, value string) error {
+	ui, err := parseUint(value)
+	if err != nil {
+		return err
+	}
+	field.SetUint(ui)
+	return nil
+}
+
+func setFloat(field reflect.Value, value string) error {
+	f, err := parseFloat(value)
+	if err != nil {
+		return err
+	}
+	field.SetFloat(f)
+	return nil
+}
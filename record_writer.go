@@ -0,0 +1,160 @@
+package xsv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QuotePolicy tells which fields XsvWriter quotes
+type QuotePolicy int
+
+const (
+	QuoteMinimal    QuotePolicy = iota // quote the fields containing the comma, the quote, the escape rune or a line break, like encoding/csv
+	QuoteAll                           // quote every field
+	QuoteNonNumeric                    // quote every field except the ones of numeric struct fields
+	QuoteNone                          // never quote, escape the special characters with the escape rune instead
+)
+
+var ErrQuotingWithoutWriter = errors.New("the quote policy, quote and escape runes and the comment rune of the dialect need a writer set with SetIOWriter, SetFileWriter or SetBufferWriter")
+
+// recordWriter writes csv records like csv.Writer, with a configurable quote policy, quote rune and escape rune
+type recordWriter struct {
+	w       *bufio.Writer
+	comma   rune
+	useCRLF bool
+	policy  QuotePolicy
+	quote   rune
+	escape  rune // 0 doubles the quote in quoted fields, and means '\\' with QuoteNone
+	comment rune // first fields starting with this rune are quoted so that the line is not read as a comment, 0 for none
+}
+
+func newRecordWriter(w io.Writer, comma rune, useCRLF bool, policy QuotePolicy, quote, escape rune) (*recordWriter, error) {
+	if quote == 0 {
+		quote = '"'
+	}
+	if escape == 0 && policy == QuoteNone {
+		escape = '\\'
+	}
+	if quote == comma || escape == comma || quote == '\r' || quote == '\n' || escape == '\r' || escape == '\n' {
+		return nil, errors.New("invalid quote or escape rune")
+	}
+	return &recordWriter{
+		w:       bufio.NewWriter(w),
+		comma:   comma,
+		useCRLF: useCRLF,
+		policy:  policy,
+		quote:   quote,
+		escape:  escape,
+	}, nil
+}
+
+// write writes a record, numeric tells which fields come from numeric struct fields and is nil for the header
+func (w *recordWriter) write(record []string, numeric []bool) error {
+	for n, field := range record {
+		if n > 0 {
+			if _, err := w.w.WriteRune(w.comma); err != nil {
+				return err
+			}
+		}
+		var err error
+		switch {
+		case w.policy == QuoteNone:
+			err = w.writeEscaped(field)
+		case w.policy == QuoteAll,
+			w.policy == QuoteNonNumeric && !(n < len(numeric) && numeric[n]),
+			w.fieldNeedsQuotes(field),
+			n == 0 && w.comment != 0 && strings.HasPrefix(field, string(w.comment)):
+			err = w.writeQuoted(field)
+		default:
+			_, err = w.w.WriteString(field)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	if w.useCRLF {
+		_, err = w.w.WriteString("\r\n")
+	} else {
+		err = w.w.WriteByte('\n')
+	}
+	return err
+}
+
+// fieldNeedsQuotes mirrors csv.Writer, with the quote and escape runes of the writer
+func (w *recordWriter) fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` {
+		return true
+	}
+	if strings.ContainsRune(field, w.comma) || strings.ContainsRune(field, w.quote) || strings.ContainsAny(field, "\r\n") {
+		return true
+	}
+	if w.escape != 0 && strings.ContainsRune(field, w.escape) {
+		return true
+	}
+	r1, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r1)
+}
+
+func (w *recordWriter) writeQuoted(field string) error {
+	if _, err := w.w.WriteRune(w.quote); err != nil {
+		return err
+	}
+	for _, r := range field {
+		var err error
+		switch {
+		case r == w.quote && w.escape == 0:
+			_, err = w.w.WriteString(string([]rune{w.quote, w.quote}))
+		case r == w.quote || r == w.escape:
+			_, err = w.w.WriteString(string([]rune{w.escape, r}))
+		case r == '\r':
+			if !w.useCRLF {
+				err = w.w.WriteByte('\r')
+			}
+		case r == '\n':
+			if w.useCRLF {
+				_, err = w.w.WriteString("\r\n")
+			} else {
+				err = w.w.WriteByte('\n')
+			}
+		default:
+			_, err = w.w.WriteRune(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.w.WriteRune(w.quote)
+	return err
+}
+
+func (w *recordWriter) writeEscaped(field string) error {
+	for _, r := range field {
+		var err error
+		switch r {
+		case w.comma, w.quote, w.escape:
+			_, err = w.w.WriteString(string([]rune{w.escape, r}))
+		case '\r':
+			_, err = w.w.WriteString(string(w.escape) + "r")
+		case '\n':
+			_, err = w.w.WriteString(string(w.escape) + "n")
+		default:
+			_, err = w.w.WriteRune(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *recordWriter) flush() error {
+	return w.w.Flush()
+}
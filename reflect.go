@@ -20,8 +20,18 @@ type structInfo struct {
 type fieldInfo struct {
 	keys         []string
 	omitEmpty    bool
+	raw          bool // written and read as is, without formula protection
 	IndexChain   []int
 	defaultValue string
+	format       *fieldFormat // format directives of the tag, nil when there are none
+	fixed        *fixedLayout // geometry of the column in fixed-width files set by the width tag, nil when there is none
+	position     int          // csv column bound by the index= or pos= tag option in files without headers, -1 when not set
+	positions    int          // number of columns bound from position, more than 1 for pos=a-b ranges on slice fields
+	positionErr  error        // invalid index= or pos= tag option, reported when reading without headers
+	order        int          // sort key of the written column set by the order= tag option
+	ordered      bool         // the order= tag option is set, the column is written before the ones without it
+	setter       fieldSetter  // compiled by getDecodePlan, nil otherwise
+	compute      columnFunc   // computes the column added with XsvWrite.AddColumn, nil for struct fields
 }
 
 func (f fieldInfo) getFirstKey() string {
@@ -43,6 +53,12 @@ func getStructInfo(rType reflect.Type) *structInfo {
 }
 
 func getFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []string, tagName, tagSeparator string, normalizeName Normalizer) []fieldInfo {
+	return getExpandedFieldInfos(rType, parentIndexChain, parentKeys, tagName, tagSeparator, normalizeName, nil)
+}
+
+// getExpandedFieldInfos is getFieldInfos with the number of indexed columns of the slice and array fields without a csv[] tag,
+// by indexChainKey of their IndexChain (see scanSliceLengths). Those fields keep a single column when sliceLengths is nil.
+func getExpandedFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []string, tagName, tagSeparator string, normalizeName Normalizer, sliceLengths map[string]int) []fieldInfo {
 	fieldsCount := rType.NumField()
 	fieldsList := make([]fieldInfo, 0, fieldsCount)
 	for i := 0; i < fieldsCount; i++ {
@@ -98,7 +114,14 @@ func getFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []stri
 				if currFieldInfo != nil {
 					keys = currFieldInfo.keys
 				}
-				fieldsList = append(fieldsList, getFieldInfos(fieldType, indexChain, keys, tagName, tagSeparator, normalizeName)...)
+				childFieldInfos := getExpandedFieldInfos(fieldType, indexChain, keys, tagName, tagSeparator, normalizeName, sliceLengths)
+				if currFieldInfo != nil && currFieldInfo.ordered {
+					// the columns of a struct field move together
+					for i := range childFieldInfos {
+						childFieldInfos[i].order, childFieldInfos[i].ordered = currFieldInfo.order, true
+					}
+				}
+				fieldsList = append(fieldsList, childFieldInfos...)
 				continue
 			}
 		}
@@ -109,21 +132,44 @@ func getFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []stri
 		}
 
 		if field.Type.Kind() == reflect.Slice || field.Type.Kind() == reflect.Array {
+			// When the field is a slice/array of structs, the columns of a position range are filled element by element
+			var fieldInfos []fieldInfo
+			elementColumns := 1
+			isStructSlice := field.Type.Elem().Kind() == reflect.Struct
+			if isStructSlice {
+				fieldInfos = getFieldInfos(field.Type.Elem(), []int{}, []string{}, tagName, tagSeparator, normalizeName)
+				elementColumns = max(len(fieldInfos), 1)
+			}
+			if currFieldInfo.position >= 0 && currFieldInfo.positions%elementColumns != 0 {
+				currFieldInfo.positionErr = fmt.Errorf("field %s: column range of %d columns for elements of %d columns", field.Name, currFieldInfo.positions, elementColumns)
+			} else if field.Type.Kind() == reflect.Array && currFieldInfo.positions/elementColumns > field.Type.Len() {
+				currFieldInfo.positionErr = fmt.Errorf("field %s: column range of %d columns for %d elements", field.Name, currFieldInfo.positions, field.Type.Len())
+			}
+			if currFieldInfo.positionErr != nil {
+				fieldsList = append(fieldsList, *currFieldInfo)
+				continue
+			}
+
 			var arrayLength = -1
 			if arrayTag, ok := field.Tag.Lookup(tagName + "[]"); ok {
 				arrayLength, _ = strconv.Atoi(arrayTag)
+			} else if currFieldInfo.positions > 1 || (isStructSlice && currFieldInfo.positions > 0) {
+				arrayLength = currFieldInfo.positions / elementColumns
+			} else if length, ok := sliceLengths[indexChainKey(indexChain)]; ok {
+				if length == 0 {
+					continue // every slice is empty, no column to expand
+				}
+				arrayLength = length
 			}
 
 			// When the field is a slice/array of structs, create a fieldInfo for each index and each field
-			if field.Type.Elem().Kind() == reflect.Struct {
-				fieldInfos := getFieldInfos(field.Type.Elem(), []int{}, []string{}, tagName, tagSeparator, normalizeName)
-
+			if isStructSlice {
 				for idx := 0; idx < arrayLength; idx++ {
 					// copy index chain and append array index
 					var cpy2 = make([]int, len(indexChain))
 					copy(cpy2, indexChain)
 					arrayIndexChain := append(cpy2, idx)
-					for _, childFieldInfo := range fieldInfos {
+					for childIdx, childFieldInfo := range fieldInfos {
 						// copy array index chain and append array index
 						var cpy3 = make([]int, len(arrayIndexChain))
 						copy(cpy3, arrayIndexChain)
@@ -131,7 +177,19 @@ func getFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []stri
 						arrayFieldInfo := fieldInfo{
 							IndexChain:   append(cpy3, childFieldInfo.IndexChain...),
 							omitEmpty:    childFieldInfo.omitEmpty,
+							raw:          childFieldInfo.raw,
 							defaultValue: childFieldInfo.defaultValue,
+							format:       childFieldInfo.format,
+							fixed:        childFieldInfo.fixed,
+							position:     -1,
+							order:        childFieldInfo.order,
+							ordered:      childFieldInfo.ordered,
+						}
+						if currFieldInfo.ordered {
+							arrayFieldInfo.order, arrayFieldInfo.ordered = currFieldInfo.order, true
+						}
+						if currFieldInfo.position >= 0 && idx < currFieldInfo.positions/elementColumns {
+							arrayFieldInfo.position = currFieldInfo.position + idx*elementColumns + childIdx
 						}
 
 						// create cartesian product of keys
@@ -155,7 +213,16 @@ func getFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []stri
 					arrayFieldInfo := fieldInfo{
 						IndexChain:   append(cpy2, idx),
 						omitEmpty:    currFieldInfo.omitEmpty,
+						raw:          currFieldInfo.raw,
 						defaultValue: currFieldInfo.defaultValue,
+						format:       currFieldInfo.format,
+						fixed:        currFieldInfo.fixed,
+						position:     -1,
+						order:        currFieldInfo.order,
+						ordered:      currFieldInfo.ordered,
+					}
+					if currFieldInfo.position >= 0 && idx < currFieldInfo.positions {
+						arrayFieldInfo.position = currFieldInfo.position + idx
 					}
 
 					for _, akey := range currFieldInfo.keys {
@@ -168,6 +235,9 @@ func getFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []stri
 				fieldsList = append(fieldsList, *currFieldInfo)
 			}
 		} else {
+			if currFieldInfo.positions > 1 && currFieldInfo.positionErr == nil {
+				currFieldInfo.positionErr = fmt.Errorf("field %s: column range on a field that is not a slice", field.Name)
+			}
 			fieldsList = append(fieldsList, *currFieldInfo)
 		}
 	}
@@ -175,18 +245,40 @@ func getFieldInfos(rType reflect.Type, parentIndexChain []int, parentKeys []stri
 }
 
 func filterTags(tagName string, indexChain []int, field reflect.StructField, tagSeparator string, normalizeName Normalizer) (*fieldInfo, []string) {
-	currFieldInfo := fieldInfo{IndexChain: indexChain}
+	currFieldInfo := fieldInfo{IndexChain: indexChain, position: -1}
+	if width, ok := field.Tag.Lookup("width"); ok {
+		currFieldInfo.fixed = newFixedLayout(width, field.Tag.Get("align"), field.Tag.Get("pad"))
+	}
 
 	fieldTag := field.Tag.Get(tagName)
 	fieldTags := strings.Split(fieldTag, tagSeparator)
 
 	filteredTags := []string{}
-	for _, fieldTagEntry := range fieldTags {
+	for i, fieldTagEntry := range fieldTags {
 		trimmedFieldTagEntry := strings.TrimSpace(fieldTagEntry) // handles cases like `csv:"foo, omitempty, default=test"`
 		if trimmedFieldTagEntry == "omitempty" {
 			currFieldInfo.omitEmpty = true
 		} else if strings.HasPrefix(trimmedFieldTagEntry, "default=") {
 			currFieldInfo.defaultValue = strings.TrimPrefix(trimmedFieldTagEntry, "default=")
+		} else if i == 0 {
+			// the other options are only recognised after the name, which may be empty as in `csv:",pos=4"`
+			filteredTags = append(filteredTags, normalizeName(trimmedFieldTagEntry))
+		} else if trimmedFieldTagEntry == "raw" {
+			currFieldInfo.raw = true
+		} else if strings.HasPrefix(trimmedFieldTagEntry, "index=") || strings.HasPrefix(trimmedFieldTagEntry, "pos=") {
+			_, position, _ := strings.Cut(trimmedFieldTagEntry, "=")
+			currFieldInfo.position, currFieldInfo.positions, currFieldInfo.positionErr = parsePosition(position)
+			if currFieldInfo.positionErr != nil {
+				currFieldInfo.positionErr = fmt.Errorf("field %s: %w", field.Name, currFieldInfo.positionErr)
+			}
+		} else if strings.HasPrefix(trimmedFieldTagEntry, "order=") {
+			currFieldInfo.order, _ = strconv.Atoi(strings.TrimPrefix(trimmedFieldTagEntry, "order="))
+			currFieldInfo.ordered = true
+		} else if name, value, ok := strings.Cut(trimmedFieldTagEntry, "="); ok && isFormatDirective(name) {
+			if currFieldInfo.format == nil {
+				currFieldInfo.format = newFieldFormat()
+			}
+			currFieldInfo.format.setDirective(name, value)
 		} else {
 			filteredTags = append(filteredTags, normalizeName(trimmedFieldTagEntry))
 		}
@@ -195,6 +287,92 @@ func filterTags(tagName string, indexChain []int, field reflect.StructField, tag
 	return &currFieldInfo, filteredTags
 }
 
+// parsePosition parses the 0-based column of an index= or pos= tag option, either "4" or a range such as "5-9"
+func parsePosition(s string) (position int, positions int, err error) {
+	first, last, isRange := strings.Cut(s, "-")
+	position, err = strconv.Atoi(first)
+	if err != nil || position < 0 {
+		return -1, 0, fmt.Errorf("invalid column position %q", s)
+	}
+	if !isRange {
+		return position, 1, nil
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil || end < position {
+		return -1, 0, fmt.Errorf("invalid column range %q", s)
+	}
+	return position, end - position + 1, nil
+}
+
+// scanSliceLengths records in sliceLengths the largest length of the slice and array fields of v and of its nested structs,
+// by indexChainKey of their IndexChain. Fields with a csv[] tag, byte slices and the fields of slice elements are not scanned.
+func scanSliceLengths(v reflect.Value, parentIndexChain []int, tagName string, sliceLengths map[string]int) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		indexChain := append(append(make([]int, 0, len(parentIndexChain)+1), parentIndexChain...), i)
+
+		switch fieldType := field.Type; fieldType.Kind() {
+		case reflect.Slice, reflect.Array:
+			if _, ok := field.Tag.Lookup(tagName + "[]"); ok || fieldType.Elem().Kind() == reflect.Uint8 {
+				continue
+			}
+			key := indexChainKey(indexChain)
+			if length, ok := sliceLengths[key]; !ok || v.Field(i).Len() > length {
+				sliceLengths[key] = v.Field(i).Len()
+			}
+		case reflect.Struct, reflect.Ptr:
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct && !canMarshal(fieldType) {
+				scanSliceLengths(v.Field(i), indexChain, tagName, sliceLengths)
+			}
+		}
+	}
+}
+
+func indexChainKey(indexChain []int) string {
+	return fmt.Sprint(indexChain)
+}
+
+// addressable returns value, or a copy of it when it is not addressable, so that the fields and values
+// marshalled through methods with a pointer receiver are written like the others
+func addressable(value reflect.Value) reflect.Value {
+	if value.CanAddr() {
+		return value
+	}
+	cell := reflect.New(value.Type()).Elem()
+	cell.Set(value)
+	return cell
+}
+
+// fieldTypeByIndex returns the type of the field reached by an IndexChain, following pointers and slice/array elements
+func fieldTypeByIndex(t reflect.Type, index []int) reflect.Type {
+	for _, i := range index {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		} else {
+			t = t.Field(i).Type
+		}
+	}
+	return t
+}
+
 func getConcreteContainerInnerType(in reflect.Type) (inInnerWasPointer bool, inInnerType reflect.Type) {
 	inInnerType = in.Elem()
 	inInnerWasPointer = false
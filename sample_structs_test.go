@@ -185,3 +185,37 @@ type NestedSample struct {
 type NestedEmbedSample struct {
 	InnerStruct
 }
+
+type TrailerSample struct {
+	Label string `csv:"foo"`
+	Total int    `csv:"BAR"`
+}
+
+type PositionalSample struct {
+	ID     string   `csv:"id,pos=0"`
+	Amount float64  `csv:",index=3"`
+	Codes  []string `csv:"codes,pos=5-7"`
+	Note   string   `csv:"note"`
+}
+
+type FormulaSample struct {
+	Name    string `csv:"name"`
+	Formula string `csv:"formula,raw"`
+	Amount  string `csv:"amount"`
+}
+
+type FormatSample struct {
+	Price   float64 `csv:"price,format=$%.2f"`
+	Ratio   float64 `csv:"ratio,precision=4"`
+	Flag    bool    `csv:"flag,true=Y,false=N"`
+	Code    int     `csv:"code,pad=0:8"`
+	Balance *int    `csv:"balance,pad=0:6"`
+}
+
+type FixedWidthSample struct {
+	ID      string  `csv:"id" width:"4"`
+	Name    string  `csv:"name" width:"10"`
+	Amount  int     `csv:"amount" width:"8" align:"right" pad:"0"`
+	Rate    float64 `csv:"rate,format=%.2f" width:"6" align:"right"`
+	Ignored string  `csv:"ignored"`
+}
@@ -0,0 +1,212 @@
+package xsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffSize is the size of the prefix of the input inspected by Sniff
+const sniffSize = 64 << 10
+
+// sniffDelimiters are the delimiters Sniff chooses from, in order of preference
+var sniffDelimiters = []rune{',', ';', '\t', '|'}
+
+// SniffResult is the dialect and the layout of a file detected by Sniff
+type SniffResult struct {
+	Dialect   Dialect // Delimiter, LazyQuotes, FieldsPerRecord and UseCRLF as seen in the inspected prefix
+	Quoted    bool    // some fields of the inspected prefix are quoted
+	HasHeader bool    // the first record looks like a header
+}
+
+// Sniff inspects a prefix of r to detect its dialect and whether it starts with a header, see XsvRead.Sniff.
+// Without a struct to compare with, a first record is taken as a header when its cells do not look like the cells below.
+func Sniff(r io.Reader) (SniffResult, io.Reader, error) {
+	return sniff(r, nil)
+}
+
+// Sniff inspects a prefix of r to detect its dialect and whether it starts with a header.
+// When T is a struct, the first record is a header when at least HeaderMinMatches of its cells (1 when not set) match the struct tags.
+// The returned reader replays the inspected prefix followed by the rest of r, to be given to SetIOReader:
+//
+//	result, replay, err := xsvRead.Sniff(file)
+//	xsvRead.Dialect = result.Dialect
+//	reader := xsvRead.SetIOReader(replay)
+func (x *XsvRead[T]) Sniff(r io.Reader) (SniffResult, io.Reader, error) {
+	_, outInnerType := getConcreteContainerInnerType(reflect.TypeOf((*[]T)(nil)).Elem())
+	if outInnerType.Kind() != reflect.Struct {
+		return sniff(r, nil)
+	}
+	structInfo := getDecodePlan(outInnerType, x.TagName, x.TagSeparator, x.NameNormalizer).structInfo
+	minMatches := max(x.HeaderMinMatches, 1)
+	return sniff(r, func(record []string) bool {
+		matches := 0
+		for _, cell := range record {
+			cell = x.NameNormalizer(cell)
+			for _, field := range structInfo.Fields {
+				if field.matchesKey(cell) {
+					matches++
+					break
+				}
+			}
+		}
+		return matches >= minMatches
+	})
+}
+
+// sniff detects the dialect of a prefix of r, isHeader tells whether the first record is a header when it is not nil
+func sniff(r io.Reader, isHeader func([]string) bool) (SniffResult, io.Reader, error) {
+	prefix := make([]byte, sniffSize)
+	n, err := io.ReadFull(r, prefix)
+	prefix = prefix[:n]
+	replay := io.MultiReader(bytes.NewReader(prefix), r)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return SniffResult{}, replay, err
+	}
+	sample := prefix
+	if err == nil {
+		// the input goes on, leave the last line out since it may be cut
+		if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+			sample = sample[:i+1]
+		}
+	}
+	if len(bytes.TrimSpace(sample)) == 0 {
+		return SniffResult{}, replay, ErrEmptyCSVFile
+	}
+
+	var result SniffResult
+	var records [][]string
+	bestScore := -1.0
+	for _, delimiter := range sniffDelimiters {
+		for _, lazyQuotes := range []bool{false, true} {
+			candidate, score := sniffRecords(sample, delimiter, lazyQuotes)
+			if candidate != nil && score > bestScore {
+				bestScore, records = score, candidate
+				result.Dialect = Dialect{Delimiter: delimiter, LazyQuotes: lazyQuotes}
+			}
+			if candidate != nil {
+				break // the strict parse succeeded, no need for lazy quotes
+			}
+		}
+	}
+	if records == nil {
+		return SniffResult{}, replay, errors.New("cannot detect the delimiter of the file")
+	}
+
+	for _, record := range records[1:] {
+		if len(record) != len(records[0]) {
+			result.Dialect.FieldsPerRecord = -1
+			break
+		}
+	}
+	result.Dialect.UseCRLF = bytes.Contains(sample, []byte("\r\n"))
+	result.Quoted = sniffQuoted(sample, result.Dialect.Delimiter)
+	if isHeader != nil {
+		result.HasHeader = isHeader(records[0])
+	} else {
+		result.HasHeader = looksLikeHeader(records)
+	}
+	return result, replay, nil
+}
+
+// sniffRecords parses sample with delimiter and scores how well the delimiter fits it: the share of the records
+// having the most common number of fields, then the share of the fields that are not fragments (see wholeFields),
+// then the number of fields to break ties. It returns nil records when the sample cannot be parsed.
+func sniffRecords(sample []byte, delimiter rune, lazyQuotes bool) ([][]string, float64) {
+	reader := csv.NewReader(bytes.NewReader(sample))
+	reader.Comma = delimiter
+	reader.LazyQuotes = lazyQuotes
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, 0
+	}
+	counts := map[int]int{}
+	mostCommon := 0
+	for _, record := range records {
+		counts[len(record)]++
+		if counts[len(record)] > counts[mostCommon] || (counts[len(record)] == counts[mostCommon] && len(record) > mostCommon) {
+			mostCommon = len(record)
+		}
+	}
+	if mostCommon < 2 {
+		return records, 0 // a single column fits any delimiter
+	}
+	return records, float64(counts[mostCommon])/float64(len(records))*1e6 + wholeFields(records, delimiter)*1e3 + float64(min(mostCommon, 999))
+}
+
+// wholeFields returns the share of the fields that are numbers, with a decimal point or a decimal comma,
+// or that hold none of the other delimiters. Splitting "foo;1,5" on the comma leaves the fragments "foo;1" and "5",
+// the first one still holding the semicolon that separates the fields.
+func wholeFields(records [][]string, delimiter rune) float64 {
+	fields, whole := 0, 0
+	for _, record := range records {
+		for _, field := range record {
+			fields++
+			trimmed := strings.TrimSpace(field)
+			if _, err := strconv.ParseFloat(strings.Replace(trimmed, ",", ".", 1), 64); err == nil && trimmed != "" {
+				whole++
+				continue
+			}
+			if !strings.ContainsFunc(field, func(r rune) bool { return r != delimiter && slices.Contains(sniffDelimiters, r) }) {
+				whole++
+			}
+		}
+	}
+	return float64(whole) / float64(fields)
+}
+
+// sniffQuoted tells whether a field of sample starts with a quote
+func sniffQuoted(sample []byte, delimiter rune) bool {
+	delimited := append(utf8.AppendRune(nil, delimiter), '"')
+	return sample[0] == '"' || bytes.Contains(sample, []byte("\n\"")) || bytes.Contains(sample, delimited)
+}
+
+// looksLikeHeader votes for each column whose cells below the first record are all numbers, or all have the same length:
+// the column is for a header when its first cell does not, and against otherwise.
+func looksLikeHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return false
+	}
+	votes := 0
+	for i, cell := range records[0] {
+		numeric, length := true, -1
+		for _, record := range records[1:] {
+			if i >= len(record) {
+				numeric, length = false, -2
+				break
+			}
+			if _, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64); err != nil {
+				numeric = false
+			}
+			switch {
+			case length == -1:
+				length = len(record[i])
+			case length != len(record[i]):
+				length = -2
+			}
+		}
+		_, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		switch {
+		case numeric:
+			if err != nil {
+				votes++
+			} else {
+				votes--
+			}
+		case length >= 0:
+			if len(cell) != length {
+				votes++
+			} else {
+				votes--
+			}
+		}
+	}
+	return votes > 0
+}
@@ -17,6 +17,7 @@ import (
 var (
 	marshallerType             = reflect.TypeOf(new(TypeMarshaller)).Elem()
 	textMarshallerType         = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+	textUnmarshalerType        = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
 	unmarshalerType            = reflect.TypeOf(new(TypeUnmarshaller)).Elem()
 	unmarshalCSVWithFieldsType = reflect.TypeOf(new(TypeUnmarshalCSVWithFields)).Elem()
 )
@@ -96,15 +97,7 @@ func toBool(in interface{}) (bool, error) {
 
 	switch inValue.Kind() {
 	case reflect.String:
-		s := inValue.String()
-		s = strings.TrimSpace(s)
-		if strings.EqualFold(s, "yes") {
-			return true, nil
-		} else if strings.EqualFold(s, "no") || s == "" {
-			return false, nil
-		} else {
-			return strconv.ParseBool(s)
-		}
+		return parseBool(inValue.String())
 	case reflect.Bool:
 		return inValue.Bool(), nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -134,12 +127,7 @@ func toInt(in interface{}) (int64, error) {
 
 	switch inValue.Kind() {
 	case reflect.String:
-		s := strings.TrimSpace(inValue.String())
-		if s == "" {
-			return 0, nil
-		}
-		out := strings.SplitN(s, ".", 2)
-		return strconv.ParseInt(out[0], 0, 64)
+		return parseInt(inValue.String())
 	case reflect.Bool:
 		if inValue.Bool() {
 			return 1, nil
@@ -160,20 +148,7 @@ func toUint(in interface{}) (uint64, error) {
 
 	switch inValue.Kind() {
 	case reflect.String:
-		s := strings.TrimSpace(inValue.String())
-		if s == "" {
-			return 0, nil
-		}
-
-		// support the float input
-		if strings.Contains(s, ".") {
-			f, err := strconv.ParseFloat(s, 64)
-			if err != nil {
-				return 0, err
-			}
-			return uint64(f), nil
-		}
-		return strconv.ParseUint(s, 0, 64)
+		return parseUint(inValue.String())
 	case reflect.Bool:
 		if inValue.Bool() {
 			return 1, nil
@@ -194,12 +169,7 @@ func toFloat(in interface{}) (float64, error) {
 
 	switch inValue.Kind() {
 	case reflect.String:
-		s := strings.TrimSpace(inValue.String())
-		if s == "" {
-			return 0, nil
-		}
-		s = strings.Replace(s, ",", ".", -1)
-		return strconv.ParseFloat(s, 64)
+		return parseFloat(inValue.String())
 	case reflect.Bool:
 		if inValue.Bool() {
 			return 1, nil
@@ -215,6 +185,52 @@ func toFloat(in interface{}) (float64, error) {
 	return 0, fmt.Errorf("No known conversion from " + inValue.Type().String() + " to float")
 }
 
+func parseBool(s string) (bool, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "yes") {
+		return true, nil
+	} else if strings.EqualFold(s, "no") || s == "" {
+		return false, nil
+	} else {
+		return strconv.ParseBool(s)
+	}
+}
+
+func parseInt(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	out := strings.SplitN(s, ".", 2)
+	return strconv.ParseInt(out[0], 0, 64)
+}
+
+func parseUint(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	// support the float input
+	if strings.Contains(s, ".") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(f), nil
+	}
+	return strconv.ParseUint(s, 0, 64)
+}
+
+func parseFloat(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	s = strings.Replace(s, ",", ".", -1)
+	return strconv.ParseFloat(s, 64)
+}
+
 func setField(field reflect.Value, value string, omitEmpty bool) error {
 	if field.Kind() == reflect.Ptr {
 		if field.IsNil() {
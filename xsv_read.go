@@ -1,9 +1,12 @@
 package xsv
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/csv"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 )
 
@@ -13,10 +16,23 @@ type XsvRead[T any] struct {
 	TagSeparator                                    string    //separator string for multiple csv tags in struct fields
 	FailIfUnmatchedStructTags                       bool      // indicates whether it is considered an error when there is an unmatched struct tag.
 	FailIfDoubleHeaderNames                         bool      // indicates whether it is considered an error when a header name is repeated in the csv header.
+	FailIfExtraColumns                              bool      // indicates whether it is considered an error when a record read without headers has cells in columns not bound to struct fields.
+	FailIfUnknownKeys                               bool      // indicates whether it is considered an error when MergeInto reads a record whose key is not in the existing collection.
+	StripFormulaProtection                          bool      // removes the formula protection added by XsvWrite.FormulaProtection, except for the fields tagged raw
 	ShouldAlignDuplicateHeadersWithStructFieldOrder bool      // indicates whether we should align duplicate CSV headers per their alignment in the struct definition.
 	OnRecord                                        func(T) T // callback function to be called on each record
 	NameNormalizer                                  Normalizer
 	ErrorHandler                                    ErrorHandler
+	MaxErrors                                       int                 // number of cell errors to collect and return together as DecodeErrors, negative means no limit and 0 disables collecting
+	SkipLines                                       int                 // number of lines to skip at the beginning of the file, before the header
+	CommentPrefix                                   string              // records whose line starts with this prefix are skipped, see SetIOReader for malformed lines
+	SkipPattern                                     *regexp.Regexp      // records whose line matches this pattern are skipped, see SetIOReader for malformed lines
+	HeaderMinMatches                                int                 // when greater than 0, the header is the first record with at least this many cells matching the struct tags
+	TrailerSentinel                                 string              // the trailer starts at the first record whose first cell is this value
+	TrailerPattern                                  *regexp.Regexp      // the trailer starts at the first record whose line matches this pattern
+	TrailerMatch                                    func([]string) bool // the trailer starts at the first record for which this function returns true
+	TrailerRecords                                  int                 // number of records at the end of the file that belong to the trailer
+	Dialect                                         Dialect             // syntax of the file, applied to the csv.Reader unless it is the zero value
 }
 
 // NewXsvRead creates a new XsvRead struct with default configuration values
@@ -26,27 +42,56 @@ func NewXsvRead[T any]() *XsvRead[T] {
 		TagSeparator:              ",",
 		FailIfUnmatchedStructTags: false,
 		FailIfDoubleHeaderNames:   false,
+		FailIfExtraColumns:        false,
+		FailIfUnknownKeys:         false,
+		StripFormulaProtection:    false,
 		ShouldAlignDuplicateHeadersWithStructFieldOrder: false,
-		OnRecord:       nil,
-		NameNormalizer: func(s string) string { return s },
-		ErrorHandler:   nil,
+		OnRecord:         nil,
+		NameNormalizer:   func(s string) string { return s },
+		ErrorHandler:     nil,
+		MaxErrors:        0,
+		SkipLines:        0,
+		CommentPrefix:    "",
+		SkipPattern:      nil,
+		HeaderMinMatches: 0,
+		TrailerSentinel:  "",
+		TrailerPattern:   nil,
+		TrailerMatch:     nil,
+		TrailerRecords:   0,
+		Dialect:          Dialect{},
 	}
 }
 
 func (x *XsvRead[T]) SetReader(r *csv.Reader) (xr *XsvReader[T]) {
 	xr = NewXsvReader(*x)
 	xr.reader = r
+	if x.Dialect.isSet() {
+		x.Dialect.applyToReader(r)
+	}
+	return xr
+}
+
+// SetIOReader reads the csv from r. Unlike with SetReader, the lines skipped by SkipLines, CommentPrefix and SkipPattern,
+// and the lines before the header located by HeaderMinMatches, are dropped before being parsed, so they do not need to be valid csv.
+func (x *XsvRead[T]) SetIOReader(r io.Reader) (xr *XsvReader[T]) {
+	if x.SkipLines <= 0 && x.CommentPrefix == "" && x.SkipPattern == nil && x.HeaderMinMatches <= 0 {
+		return x.SetReader(csv.NewReader(r)) // no line to drop, the csv.Reader reads r directly
+	}
+	lines := newLineFilter(bufio.NewReader(r), x.SkipLines, x.CommentPrefix, x.SkipPattern)
+	xr = x.SetReader(csv.NewReader(lines))
+	lines.reader = xr.reader
+	xr.lines = lines
 	return xr
 }
 
 func (x *XsvRead[T]) SetFileReader(file *os.File) (xr *XsvReader[T]) {
-	return x.SetReader(csv.NewReader(file))
+	return x.SetIOReader(file)
 }
 
 func (x *XsvRead[T]) SetStringReader(string string) (xr *XsvReader[T]) {
-	return x.SetReader(csv.NewReader(strings.NewReader(string)))
+	return x.SetIOReader(strings.NewReader(string))
 }
 
 func (x *XsvRead[T]) SetByteReader(byte []byte) (xr *XsvReader[T]) {
-	return x.SetReader(csv.NewReader(bytes.NewReader(byte)))
+	return x.SetIOReader(bytes.NewReader(byte))
 }
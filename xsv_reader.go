@@ -1,14 +1,43 @@
 package xsv
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
+	"fmt"
 	"io"
+	"iter"
 	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 )
 
 type XsvReader[T any] struct {
 	XsvRead[T]
 	reader *csv.Reader
+	lines  *lineFilter // drops the skipped lines before the reader parses them, nil when the reader was given to SetReader
+
+	// cursor state used by Next, Value, Err and All
+	withoutHeaders bool           // map the columns to the struct fields by position
+	rowCountHint   int            // expected number of records, used to pre-size the slice filled by ReadTo
+	decoder        *recordDecoder // created from the header on the first call to Next
+	value          T
+	err            error
+	done           bool
+
+	// trailer state
+	inBody    bool             // the header has been read, the next records may start the trailer
+	lookahead []bufferedRecord // records held back until more than TrailerRecords records follow them
+	trailer   []bufferedRecord // records after the end of the data, see Trailer
+}
+
+// bufferedRecord is a csv record read ahead with the line it starts at and its parse error, if any
+type bufferedRecord struct {
+	record []string
+	line   int
+	err    error
 }
 
 func NewXsvReader[T any](xsvRead XsvRead[T]) *XsvReader[T] {
@@ -21,37 +50,32 @@ func (r *XsvReader[T]) Lazy() *XsvReader[T] {
 	return r
 }
 
-func (r *XsvReader[T]) ReadTo(out *[]T) error {
-	outValue, outType := getConcreteReflectValueAndType(out) // Get the concrete type (not pointer) (Slice<?> or Array<?>)
-
-	outInnerWasPointer, outInnerType := getConcreteContainerInnerType(outType) // Get the concrete inner type (not pointer) (Container<"?">)
-	if err := ensureOutInnerType(outInnerType); err != nil {
-		return err
-	}
-	csvRows, err := r.reader.ReadAll() // Get the CSV csvRows
-	if err != nil {
-		return err
-	}
-	if len(csvRows) == 0 {
-		return ErrEmptyCSVFile
-	}
-	if err := ensureOutCapacity(&outValue, len(csvRows)); err != nil { // Ensure the container is big enough to hold the CSV content
-		return err
-	}
-	fieldInfos := getFieldInfos(outInnerType, []int{}, []string{}, r.TagName, r.TagSeparator, r.NameNormalizer) // Get the inner struct info to get CSV annotations
-	outInnerStructInfo := &structInfo{fieldInfos}
-	if len(outInnerStructInfo.Fields) == 0 {
-		return ErrNoStructTags
-	}
-
-	headers := make([]string, len(csvRows[0]))
-	for i, h := range csvRows[0] { // apply normalizer func to headers
+// mapHeaders applies the normalizer to the csv headers and maps each csv column position to its struct field
+func (r *XsvReader[T]) mapHeaders(headers []string, outInnerStructInfo *structInfo) ([]*fieldInfo, error) {
+	for i, h := range headers { // apply normalizer func to headers
+		if r.StripFormulaProtection { // the writer protects the names of the columns like the cells
+			h = stripFormulaProtection(h)
+		}
 		headers[i] = r.NameNormalizer(h)
 	}
-	body := csvRows[1:]
 
-	csvHeadersLabels := make(map[int]*fieldInfo, len(outInnerStructInfo.Fields)) // Used to store the correspondance header <-> position in CSV
+	csvHeadersLabels := r.matchHeaders(headers, outInnerStructInfo)
+	if r.FailIfUnmatchedStructTags {
+		if err := maybeMissingStructFields(outInnerStructInfo.Fields, headers); err != nil {
+			return nil, err
+		}
+	}
+	if r.FailIfDoubleHeaderNames {
+		if err := maybeDoubleHeaderNames(headers); err != nil {
+			return nil, err
+		}
+	}
+	return csvHeadersLabels, nil
+}
 
+// matchHeaders maps each normalized csv header to its struct field
+func (r *XsvReader[T]) matchHeaders(headers []string, outInnerStructInfo *structInfo) []*fieldInfo {
+	csvHeadersLabels := make([]*fieldInfo, len(headers))
 	headerCount := map[string]int{}
 	for i, csvColumnHeader := range headers {
 		curHeaderCount := headerCount[csvColumnHeader]
@@ -63,304 +87,639 @@ func (r *XsvReader[T]) ReadTo(out *[]T) error {
 			}
 		}
 	}
+	return csvHeadersLabels
+}
 
-	if r.FailIfUnmatchedStructTags {
-		if err := maybeMissingStructFields(outInnerStructInfo.Fields, headers); err != nil {
+// RowCountHint sets the expected number of records so that ReadTo and ReadToWithoutHeaders can pre-size the output slice
+func (r *XsvReader[T]) RowCountHint(rows int) *XsvReader[T] {
+	r.rowCountHint = rows
+	return r
+}
+
+// ReadTo decodes the records one by one into out.
+// Existing elements of out are overwritten in order and the slice only grows when the csv has more records than out.
+func (r *XsvReader[T]) ReadTo(out *[]T) error {
+	return r.readTo(out)
+}
+
+func (r *XsvReader[T]) readTo(out *[]T) error {
+	rows := *out
+	if r.rowCountHint > cap(rows) {
+		rows = slices.Grow(rows, r.rowCountHint-len(rows))
+	}
+	i := 0
+	for ; r.Next(); i++ {
+		if i < len(rows) {
+			rows[i] = r.Value()
+		} else {
+			rows = append(rows, r.Value())
+		}
+	}
+	*out = rows
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if i == 0 && r.withoutHeaders {
+		return ErrEmptyCSVFile
+	}
+	return nil
+}
+
+func (r *XsvReader[T]) ReadEach(c chan T) error {
+	return r.ReadEachContext(context.Background(), c)
+}
+
+// ReadEachContext sends each record to c and closes c once the file has been read.
+// It stops and returns ctx.Err() as soon as ctx is done, including while blocked on sending to c.
+// Like ReadTo, it returns ErrEmptyCSVFile for an empty file without even a header, where ReadEach used to return io.EOF.
+func (r *XsvReader[T]) ReadEachContext(ctx context.Context, c chan T) error {
+	defer close(c)
+	for {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
+		if !r.Next() {
+			return r.Err()
+		}
+		select {
+		case c <- r.Value():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	if r.FailIfDoubleHeaderNames {
-		if err := maybeDoubleHeaderNames(headers); err != nil {
+}
+
+// ReadEachParallel works like ReadEachContext but decodes the records with several goroutines.
+// One goroutine reads the csv records, workers goroutines decode them and the records are sent to c
+// in the order of the file. OnRecord and ErrorHandler are called from the calling goroutine in the order
+// of the file too, but unmarshallers of the struct fields must be safe for concurrent use.
+// If workers is less than 1, runtime.GOMAXPROCS(0) workers are used.
+// When ctx is done or an error stops it early, ReadEachParallel returns without waiting for a read of the source
+// in progress: the reader must not be used afterwards, and the source must be closed to release the goroutine blocked reading it.
+func (r *XsvReader[T]) ReadEachParallel(ctx context.Context, workers int, c chan T) error {
+	defer close(c)
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if r.decoder == nil {
+		if err := r.prepareDecoder(); err != nil {
 			return err
 		}
 	}
 
-	var withFieldsOK bool
-	var fieldTypeUnmarshallerWithKeys TypeUnmarshalCSVWithFields
-
-	for i, csvRow := range body {
-		objectIface := reflect.New(outValue.Index(i).Type()).Interface()
-		outInner := createNewOutInner(outInnerWasPointer, outInnerType)
-		for j, csvColumnContent := range csvRow {
-			if fieldInfo, ok := csvHeadersLabels[j]; ok { // Position found accordingly to header name
-
-				if outInner.CanInterface() {
-					fieldTypeUnmarshallerWithKeys, withFieldsOK = objectIface.(TypeUnmarshalCSVWithFields)
-					if withFieldsOK {
-						if err := fieldTypeUnmarshallerWithKeys.UnmarshalCSVWithFields(fieldInfo.getFirstKey(), csvColumnContent); err != nil {
-							parseError := csv.ParseError{
-								Line:   i + 2, //add 2 to account for the header & 0-indexing of arrays
-								Column: j + 1,
-								Err:    err,
-							}
-							return &parseError
-						}
-						continue
-					}
+	type job struct {
+		seq      int
+		record   []string
+		line     int
+		parseErr *csv.ParseError // malformed record, returned once the records before it have been sent
+	}
+	type result struct {
+		job
+		outInner reflect.Value
+		cellErrs []*CellError
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan job, workers)
+	results := make(chan result, workers)
+	window := make(chan struct{}, 4*workers) // bounds the number of records waiting to be sent in order
+	readErr := make(chan error, 1)
+
+	go func() { // tokenizer
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				readErr <- nil
+				return
+			}
+			j := job{seq: seq}
+			record, line, err := r.nextBodyRecord()
+			if err == io.EOF {
+				readErr <- nil
+				return
+			} else if parseErr, ok := err.(*csv.ParseError); ok {
+				j.parseErr = parseErr
+			} else if err != nil {
+				readErr <- err
+				return
+			} else {
+				if r.reader.ReuseRecord {
+					record = slices.Clone(record) // the workers decode it while the next record is read
 				}
-				value := csvColumnContent
-				if value == "" {
-					value = fieldInfo.defaultValue
+				j.record = record
+				j.line = line
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				readErr <- nil
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := result{job: j}
+				if j.parseErr == nil {
+					res.outInner, res.cellErrs = r.decoder.decode(j.record, j.line)
 				}
-				if err := setInnerField(&outInner, outInnerWasPointer, fieldInfo.IndexChain, value, fieldInfo.omitEmpty); err != nil { // Set field of struct
-					parseError := csv.ParseError{
-						Line:   i + 2, //add 2 to account for the header & 0-indexing of arrays
-						Column: j + 1,
-						Err:    err,
-					}
-					if r.ErrorHandler == nil || !r.ErrorHandler(&parseError) {
-						return &parseError
-					}
+				select {
+				case results <- res:
+				case <-ctx.Done():
 				}
 			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// stop the goroutines before returning early, without waiting for the tokenizer that may be blocked reading the source:
+	// it exits on its own, dropping its records, once the read returns
+	stop := func(err error) error {
+		cancel()
+		return err
+	}
+
+	pending := map[int]result{}
+	next := 0
+	for {
+		var res result
+		var ok bool
+		select {
+		case res, ok = <-results:
+		case <-ctx.Done():
+			return stop(ctx.Err())
+		}
+		if !ok {
+			break
 		}
+		pending[res.seq] = res
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
 
-		if withFieldsOK {
-			reflectedObject := reflect.ValueOf(objectIface)
-			outInner = reflectedObject.Elem()
+			if ready.parseErr != nil {
+				return stop(ready.parseErr)
+			}
+			if err := r.decoder.handle(ready.cellErrs); err != nil {
+				return stop(err)
+			}
+			value := ready.outInner.Interface().(T)
+			if r.OnRecord != nil {
+				value = r.OnRecord(value)
+			}
+			select {
+			case c <- value:
+			case <-ctx.Done():
+				return stop(ctx.Err())
+			}
 		}
+	}
+	if err := <-readErr; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.decoder.collected()
+}
 
-		if r.OnRecord != nil {
-			outInner = reflect.ValueOf(r.OnRecord(outInner.Interface().(T)))
+func (r *XsvReader[T]) ReadToWithoutHeaders(out *[]T) error {
+	r.withoutHeaders = true
+	return r.readTo(out)
+}
+
+func (r *XsvReader[T]) ReadEachWithoutHeaders(c chan T) error {
+	r.withoutHeaders = true
+	return r.ReadEach(c)
+}
+
+func (r *XsvReader[T]) ReadToCallback(f func(s T) error) error {
+	return r.ReadToCallbackContext(context.Background(), f)
+}
+
+// ReadToCallbackContext calls f for each record in the same goroutine.
+// It returns the first error returned by f, ctx.Err() if ctx is done before the file has been read,
+// or the error encountered while reading the file, ErrEmptyCSVFile for an empty file without even a header.
+func (r *XsvReader[T]) ReadToCallbackContext(ctx context.Context, f func(s T) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		if !r.Next() {
+			return r.Err()
+		}
+		if err := f(r.Value()); err != nil {
+			return err
+		}
+	}
+}
 
-		outValue.Index(i).Set(outInner)
+// readHeader reads the header, the first csv record accepted by accept (any record when nil)
+func (r *XsvReader[T]) readHeader(accept func([]string) bool) ([]string, error) {
+	record, err := r.nextRecord(accept)
+	if err == nil {
+		r.inBody = true
 	}
-	return nil
+	return record, err
 }
 
-func (r *XsvReader[T]) ReadEach(c chan T) error {
-	outValue, outType := getConcreteReflectValueAndType(c) // Get the concrete type (not pointer)
-	defer close(c)
+// nextBodyRecord reads the next record of the body of the file and the line it starts at, holding back the last TrailerRecords records.
+// Malformed records are returned with their *csv.ParseError once the records before them have been returned.
+func (r *XsvReader[T]) nextBodyRecord() ([]string, int, error) {
+	if r.TrailerRecords <= 0 {
+		record, err := r.nextRecord(nil)
+		line := 0
+		if record != nil {
+			line, _ = r.reader.FieldPos(0)
+		}
+		return record, line, err
+	}
 
-	headers, err := r.reader.Read()
-	if err != nil {
-		return err
+	for len(r.lookahead) <= r.TrailerRecords {
+		record, err := r.nextRecord(nil)
+		if err == io.EOF {
+			// the records held back belong to the trailer, before the ones from a matching trailer record if any
+			r.trailer = append(r.lookahead, r.trailer...)
+			r.lookahead = nil
+			return nil, 0, io.EOF
+		}
+		if _, ok := err.(*csv.ParseError); err != nil && !ok {
+			return nil, 0, err
+		}
+		line := 0
+		if record != nil {
+			line, _ = r.reader.FieldPos(0)
+			if r.reader.ReuseRecord {
+				record = slices.Clone(record)
+			}
+		}
+		r.lookahead = append(r.lookahead, bufferedRecord{record: record, line: line, err: err})
 	}
+	next := r.lookahead[0]
+	r.lookahead = r.lookahead[1:]
+	return next.record, next.line, next.err
+}
 
-	for i, h := range headers { // apply normalizer func to headers
-		headers[i] = r.NameNormalizer(h)
+// nextRecord reads the next csv record, skipping the preamble lines and the records matching
+// CommentPrefix or SkipPattern, as well as the ones not accepted by accept when it is not nil
+func (r *XsvReader[T]) nextRecord(accept func([]string) bool) ([]string, error) {
+	for {
+		fieldsPerRecord := r.reader.FieldsPerRecord
+		record, err := r.reader.Read()
+		if err == nil || errors.Is(err, csv.ErrFieldCount) {
+			if r.skipRecord(record) || (accept != nil && !accept(record)) {
+				r.reader.FieldsPerRecord = fieldsPerRecord // skipped records must not set the number of fields of the file
+				continue
+			}
+			if r.inBody && r.isTrailer(record) {
+				return nil, r.readTrailer(record)
+			}
+		}
+		return record, err
+	}
+}
+
+// isTrailer tells whether a record matches TrailerSentinel, TrailerPattern or TrailerMatch
+func (r *XsvReader[T]) isTrailer(record []string) bool {
+	if r.TrailerSentinel != "" && len(record) > 0 && strings.TrimSpace(record[0]) == r.TrailerSentinel {
+		return true
+	}
+	if r.TrailerPattern != nil && r.TrailerPattern.MatchString(strings.Join(record, string(r.reader.Comma))) {
+		return true
+	}
+	return r.TrailerMatch != nil && r.TrailerMatch(record)
+}
+
+// readTrailer stores first and all the records following it as the trailer, then returns io.EOF
+// unless one of them could not be read. The trailer records may have any number of fields.
+func (r *XsvReader[T]) readTrailer(first []string) error {
+	line, _ := r.reader.FieldPos(0)
+	r.trailer = append(r.trailer, bufferedRecord{record: slices.Clone(first), line: line})
+	r.reader.FieldsPerRecord = -1
+	for {
+		record, err := r.reader.Read()
+		if err != nil {
+			return err
+		}
+		line, _ := r.reader.FieldPos(0)
+		r.trailer = append(r.trailer, bufferedRecord{record: slices.Clone(record), line: line})
 	}
+}
 
-	outInnerWasPointer, outInnerType := getConcreteContainerInnerType(outType) // Get the concrete inner type (not pointer) (Container<"?">)
+// Trailer returns the records found after the data once the whole file has been read,
+// starting at the record matching TrailerSentinel, TrailerPattern or TrailerMatch and including the last TrailerRecords records.
+func (r *XsvReader[T]) Trailer() [][]string {
+	records := make([][]string, len(r.trailer))
+	for i, trailer := range r.trailer {
+		records[i] = trailer.record
+	}
+	return records
+}
+
+// DecodeTrailer decodes the first trailer record into out, which must be a pointer to a struct.
+// Its fields are matched with the header of the file like the fields of T, or by position when reading without headers.
+func (r *XsvReader[T]) DecodeTrailer(out any) error {
+	if len(r.trailer) == 0 {
+		return ErrNoTrailer
+	}
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() {
+		return fmt.Errorf("cannot use %T, only a non-nil pointer to a struct is supported", out)
+	}
+	outInnerType := outValue.Type().Elem()
 	if err := ensureOutInnerType(outInnerType); err != nil {
 		return err
 	}
-	fieldInfos := getFieldInfos(outInnerType, []int{}, []string{}, r.TagName, r.TagSeparator, r.NameNormalizer) // Get the inner struct info to get CSV annotations
-	outInnerStructInfo := &structInfo{fieldInfos}
+	outInnerStructInfo := getDecodePlan(outInnerType, r.TagName, r.TagSeparator, r.NameNormalizer).structInfo
 	if len(outInnerStructInfo.Fields) == 0 {
 		return ErrNoStructTags
 	}
-	csvHeadersLabels := make(map[int]*fieldInfo, len(outInnerStructInfo.Fields)) // Used to store the correspondance header <-> position in CSV
-	headerCount := map[string]int{}
-	for i, csvColumnHeader := range headers {
-		curHeaderCount := headerCount[csvColumnHeader]
-		if fieldInfo := getCSVFieldPosition(csvColumnHeader, outInnerStructInfo, curHeaderCount); fieldInfo != nil {
-			csvHeadersLabels[i] = fieldInfo
-			if r.ShouldAlignDuplicateHeadersWithStructFieldOrder {
-				curHeaderCount++
-				headerCount[csvColumnHeader] = curHeaderCount
-			}
-		}
-	}
-	if err := maybeMissingStructFields(outInnerStructInfo.Fields, headers); err != nil {
-		if r.FailIfUnmatchedStructTags {
+
+	var decoder *recordDecoder
+	if r.decoder == nil || r.decoder.headers == nil {
+		fields, err := positionalFields(outInnerStructInfo)
+		if err != nil {
 			return err
 		}
+		decoder = newRecordDecoder(nil, fields, false, outInnerType, nil, 0)
+	} else {
+		decoder = newRecordDecoder(r.decoder.headers, r.matchHeaders(r.decoder.headers, outInnerStructInfo), false, outInnerType, nil, 0)
 	}
-	if r.FailIfDoubleHeaderNames {
-		if err := maybeDoubleHeaderNames(headers); err != nil {
-			return err
-		}
+	decoder.stripFormulas = r.StripFormulaProtection
+	trailer := r.trailer[0]
+	outInner, cellErrs := decoder.decode(trailer.record, trailer.line)
+	if err := decoder.handle(cellErrs); err != nil {
+		return err
 	}
-	i := 0
-	for {
-		line, err := r.reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
+	outValue.Elem().Set(outInner)
+	return nil
+}
+
+// skipRecord tells whether a record is skipped by SkipLines, CommentPrefix or SkipPattern, when the lines were not already dropped by the lineFilter
+func (r *XsvReader[T]) skipRecord(record []string) bool {
+	if r.lines != nil {
+		return false
+	}
+	if r.SkipLines > 0 {
+		if line, _ := r.reader.FieldPos(0); line <= r.SkipLines {
+			return true
 		}
-		outInner := createNewOutInner(outInnerWasPointer, outInnerType)
-		for j, csvColumnContent := range line {
-			if fieldInfo, ok := csvHeadersLabels[j]; ok { // Position found accordingly to header name
-				if err := setInnerField(&outInner, outInnerWasPointer, fieldInfo.IndexChain, csvColumnContent, fieldInfo.omitEmpty); err != nil { // Set field of struct
-					return &csv.ParseError{
-						Line:   i + 2, //add 2 to account for the header & 0-indexing of arrays
-						Column: j + 1,
-						Err:    err,
-					}
+	}
+	if r.CommentPrefix == "" && r.SkipPattern == nil {
+		return false
+	}
+	line := strings.Join(record, string(r.reader.Comma))
+	if r.CommentPrefix != "" && strings.HasPrefix(line, r.CommentPrefix) {
+		return true
+	}
+	return r.SkipPattern != nil && r.SkipPattern.MatchString(line)
+}
+
+// isHeader tells whether a record has at least HeaderMinMatches cells matching the struct fields
+func (r *XsvReader[T]) isHeader(outInnerStructInfo *structInfo) func([]string) bool {
+	return func(record []string) bool {
+		matches := 0
+		for _, cell := range record {
+			cell = r.NameNormalizer(cell)
+			for _, field := range outInnerStructInfo.Fields {
+				if field.matchesKey(cell) {
+					matches++
+					break
 				}
 			}
 		}
-		if r.OnRecord != nil {
-			outInner = reflect.ValueOf(r.OnRecord(outInner.Interface().(T)))
-		}
-		outValue.Send(outInner)
-		i++
+		return matches >= r.HeaderMinMatches
 	}
-	return nil
 }
 
-func (r *XsvReader[T]) ReadToWithoutHeaders(out *[]T) error {
-	outValue, outType := getConcreteReflectValueAndType(out) // Get the concrete type (not pointer) (Slice<?> or Array<?>)
-
-	outInnerWasPointer, outInnerType := getConcreteContainerInnerType(outType) // Get the concrete inner type (not pointer) (Container<"?">)
+// prepareDecoder reads the header record, unless reading without headers, and prepares the decoder used by Next
+func (r *XsvReader[T]) prepareDecoder() error {
+	outInnerWasPointer, outInnerType := getConcreteContainerInnerType(reflect.TypeOf([]T(nil))) // Get the concrete inner type (not pointer) (Container<"?">)
 	if err := ensureOutInnerType(outInnerType); err != nil {
 		return err
 	}
-	csvRows, err := r.reader.ReadAll() // Get the CSV csvRows
-	if err != nil {
-		return err
+	outInnerStructInfo := getDecodePlan(outInnerType, r.TagName, r.TagSeparator, r.NameNormalizer).structInfo // Get the inner struct info to get CSV annotations
+	if len(outInnerStructInfo.Fields) == 0 {
+		return ErrNoStructTags
+	}
+	if r.withoutHeaders {
+		fields, err := positionalFields(outInnerStructInfo)
+		if err != nil {
+			return err
+		}
+		r.decoder = newRecordDecoder(nil, fields, outInnerWasPointer, outInnerType, r.ErrorHandler, r.MaxErrors)
+		r.decoder.failIfExtraColumns = r.FailIfExtraColumns
+		r.decoder.stripFormulas = r.StripFormulaProtection
+		r.inBody = true
+		return nil
 	}
-	if len(csvRows) == 0 {
+
+	var accept func([]string) bool
+	if r.HeaderMinMatches > 0 {
+		accept = r.isHeader(outInnerStructInfo)
+		if r.lines != nil {
+			r.lines.isHeader = accept
+		}
+	}
+	headers, err := r.readHeader(accept)
+	if err == io.EOF {
+		if accept != nil {
+			return ErrHeaderNotFound
+		}
 		return ErrEmptyCSVFile
+	} else if err != nil {
+		return err
 	}
-	if err := ensureOutCapacity(&outValue, len(csvRows)+1); err != nil { // Ensure the container is big enough to hold the CSV content
+	csvHeadersLabels, err := r.mapHeaders(headers, outInnerStructInfo)
+	if err != nil {
 		return err
 	}
-	fieldInfos := getFieldInfos(outInnerType, []int{}, []string{}, r.TagName, r.TagSeparator, r.NameNormalizer) // Get the inner struct info to get CSV annotations
-	outInnerStructInfo := &structInfo{fieldInfos}
-	if len(outInnerStructInfo.Fields) == 0 {
-		return ErrNoStructTags
+	r.decoder = newRecordDecoder(headers, csvHeadersLabels, outInnerWasPointer, outInnerType, r.ErrorHandler, r.MaxErrors)
+	r.decoder.stripFormulas = r.StripFormulaProtection
+	return nil
+}
+
+// Next advances the reader to the next record, which will then be available through Value.
+// The header is read on the first call. Next returns false when there are no more records
+// or when an error occurred, in which case Err returns it.
+func (r *XsvReader[T]) Next() bool {
+	if r.err != nil || r.done {
+		return false
+	}
+	if r.decoder == nil {
+		if r.err = r.prepareDecoder(); r.err != nil {
+			return false
+		}
 	}
 
-	for i, csvRow := range csvRows {
-		outInner := createNewOutInner(outInnerWasPointer, outInnerType)
-		for j, csvColumnContent := range csvRow {
-			fieldInfo := outInnerStructInfo.Fields[j]
-			if err := setInnerField(&outInner, outInnerWasPointer, fieldInfo.IndexChain, csvColumnContent, fieldInfo.omitEmpty); err != nil { // Set field of struct
-				return &csv.ParseError{
-					Line:   i + 1,
-					Column: j + 1,
-					Err:    err,
-				}
+	record, line, err := r.nextBodyRecord()
+	if err == io.EOF {
+		r.done = true
+		r.err = r.decoder.collected()
+		return false
+	} else if err != nil {
+		r.err = err
+		return false
+	}
+	outInner, cellErrs := r.decoder.decode(record, line)
+	if r.err = r.decoder.handle(cellErrs); r.err != nil {
+		return false
+	}
+	value := outInner.Interface().(T)
+	if r.OnRecord != nil {
+		value = r.OnRecord(value)
+	}
+	r.value = value
+	return true
+}
+
+// Value returns the record decoded by the last call to Next.
+func (r *XsvReader[T]) Value() T {
+	return r.value
+}
+
+// Err returns the first error encountered by Next, or nil when the whole file was read.
+// An empty file, without even a header, is an error: ErrEmptyCSVFile, unless reading without headers.
+func (r *XsvReader[T]) Err() error {
+	return r.err
+}
+
+// All returns an iterator over the remaining records. If an error occurs it is yielded
+// once with the zero value of T and the iteration stops.
+func (r *XsvReader[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for r.Next() {
+			if !yield(r.Value(), nil) {
+				return
 			}
 		}
-		if r.OnRecord != nil {
-			outInner = reflect.ValueOf(r.OnRecord(outInner.Interface().(T)))
+		if err := r.Err(); err != nil {
+			var zero T
+			yield(zero, err)
 		}
-		outValue.Index(i).Set(outInner)
 	}
-
-	return nil
 }
 
-func (r *XsvReader[T]) ReadEachWithoutHeaders(c chan T) error {
-	outValue, outType := getConcreteReflectValueAndType(c) // Get the concrete type (not pointer) (Slice<?> or Array<?>)
-	defer close(c)
-
-	outInnerWasPointer, outInnerType := getConcreteContainerInnerType(outType) // Get the concrete inner type (not pointer) (Container<"?">)
-	if err := ensureOutInnerType(outInnerType); err != nil {
-		return err
+// MergeInto reads the records into existing, matching them with its elements by key.
+// The columns present in the file overwrite the fields of the element with the same key and its other fields are left untouched.
+// Records with an unknown key are appended to existing, unless FailIfUnknownKeys is set.
+// MergeInto is a function rather than a method of XsvReader because methods cannot have type parameters.
+func MergeInto[T any, K comparable](r *XsvReader[T], existing *[]T, key func(T) K) error {
+	if r.decoder == nil {
+		if err := r.prepareDecoder(); err != nil {
+			return err
+		}
 	}
-	fieldInfos := getFieldInfos(outInnerType, []int{}, []string{}, r.TagName, r.TagSeparator, r.NameNormalizer) // Get the inner struct info to get CSV annotations
-	outInnerStructInfo := &structInfo{fieldInfos}
-	if len(outInnerStructInfo.Fields) == 0 {
-		return ErrNoStructTags
+	index := make(map[K]int, len(*existing))
+	for i, v := range *existing {
+		if _, ok := index[key(v)]; !ok {
+			index[key(v)] = i
+		}
 	}
 
-	i := 0
 	for {
-		line, err := r.reader.Read()
+		record, line, err := r.nextBodyRecord()
 		if err == io.EOF {
-			break
+			return r.decoder.collected()
 		} else if err != nil {
 			return err
 		}
-		outInner := createNewOutInner(outInnerWasPointer, outInnerType)
-		for j, csvColumnContent := range line {
-			fieldInfo := outInnerStructInfo.Fields[j]
-			if err := setInnerField(&outInner, outInnerWasPointer, fieldInfo.IndexChain, csvColumnContent, fieldInfo.omitEmpty); err != nil { // Set field of struct
-				return &csv.ParseError{
-					Line:   i + 2, //add 2 to account for the header & 0-indexing of arrays
-					Column: j + 1,
-					Err:    err,
-				}
-			}
+		outInner, cellErrs := r.decoder.decode(record, line)
+		if err := r.decoder.handle(cellErrs); err != nil {
+			return err
+		}
+		value := outInner.Interface().(T)
+		k := key(value)
+		i, ok := index[k]
+		if ok {
+			r.decoder.merge(reflect.ValueOf(*existing).Index(i), record)
+			value = (*existing)[i]
+		} else if r.FailIfUnknownKeys {
+			return fmt.Errorf("line %d: %w %v", line, ErrUnknownKey, k)
 		}
 		if r.OnRecord != nil {
-			outInner = reflect.ValueOf(r.OnRecord(outInner.Interface().(T)))
+			value = r.OnRecord(value)
 		}
-		outValue.Send(outInner)
-		i++
-	}
-	return nil
-}
-
-func (r *XsvReader[T]) ReadToCallback(f func(s T) error) error {
-	cerr := make(chan error)
-	c := make(chan T)
-	go func() {
-		cerr <- r.ReadEach(c)
-	}()
-	for {
-		select {
-		case err := <-cerr:
-			return err
-		case v, ok := <-c:
-			if !ok {
-				break
-			}
-			if err := f(v); err != nil {
-				return err
-			}
-		default:
+		if ok {
+			(*existing)[i] = value
+		} else {
+			index[k] = len(*existing)
+			*existing = append(*existing, value)
 		}
 	}
 }
 
 func (r *XsvReader[T]) ToMap() ([]map[string]string, error) {
 	var rows []map[string]string
-	var header []string
+	header, err := r.readHeader(nil)
+	if err == io.EOF {
+		return rows, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	for {
-		record, err := r.reader.Read()
+		record, _, err := r.nextBodyRecord()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return nil, err
 		}
-		if header == nil {
-			header = record
-		} else {
-			dict := map[string]string{}
-			for i := range header {
-				dict[header[i]] = record[i]
-			}
-			if r.OnRecord != nil {
-				v := r.OnRecord(reflect.ValueOf(dict).Interface().(T))
-				dict = reflect.ValueOf(v).Interface().(map[string]string)
-			}
-			rows = append(rows, dict)
+		dict := map[string]string{}
+		for i := range header {
+			dict[header[i]] = record[i]
 		}
+		if r.OnRecord != nil {
+			v := r.OnRecord(reflect.ValueOf(dict).Interface().(T))
+			dict = reflect.ValueOf(v).Interface().(map[string]string)
+		}
+		rows = append(rows, dict)
 	}
 	return rows, nil
 }
 
 func (r *XsvReader[T]) ToChanMaps(c chan<- map[string]string) error {
-	var header []string
+	header, err := r.readHeader(nil)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 	for {
-		record, err := r.reader.Read()
+		record, _, err := r.nextBodyRecord()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return err
 		}
-		if header == nil {
-			header = record
-		} else {
-			dict := map[string]string{}
-			for i := range header {
-				dict[header[i]] = record[i]
-			}
-			if r.OnRecord != nil {
-				v := r.OnRecord(reflect.ValueOf(dict).Interface().(T))
-				dict = reflect.ValueOf(v).Interface().(map[string]string)
-			}
-			c <- dict
+		dict := map[string]string{}
+		for i := range header {
+			dict[header[i]] = record[i]
+		}
+		if r.OnRecord != nil {
+			v := r.OnRecord(reflect.ValueOf(dict).Interface().(T))
+			dict = reflect.ValueOf(v).Interface().(map[string]string)
 		}
+		c <- dict
 	}
 	return nil
 }
@@ -5,33 +5,136 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
 	"slices"
 )
 
 // XsvWrite manages configuration values related to the csv write process.
 type XsvWrite[T any] struct {
-	TagName         string //key in the struct field's tag to scan
-	TagSeparator    string //separator string for multiple csv tags in struct fields
-	OmitHeaders     bool
-	SelectedColumns []string          // slice of field names to output
-	SortOrder       []int             // column sort order
-	HeaderModifier  map[string]string // map to dynamically change headers
-	OnRecord        func(T) T         // callback function to be called on each record
-	nameNormalizer  Normalizer
+	TagName           string //key in the struct field's tag to scan
+	TagSeparator      string //separator string for multiple csv tags in struct fields
+	OmitHeaders       bool
+	SelectedColumns   []string             // slice of field names to output
+	SortOrder         []int                // column sort order
+	Columns           []string             // names of the columns to output in order, "*" standing for the other columns; replaces SelectedColumns and SortOrder
+	HeaderModifier    map[string]string    // map to dynamically change headers
+	OnRecord          func(T) T            // callback function to be called on each record
+	QuotePolicy       QuotePolicy          // which fields are quoted
+	Quote             rune                 // quote character, '"' when 0
+	Escape            rune                 // escapes the quote in quoted fields instead of doubling it, and the special characters with QuoteNone ('\\' when 0)
+	FormulaProtection FormulaProtection    // how cells that a spreadsheet would run as a formula are neutralised, except for the fields tagged raw
+	Footers           map[string]Footer[T] // cells of the footer row written after the last record, by column name
+	MapColumns        []string             // columns written when T is a map or an OrderedRow, taken from the rows as told by MapHeader when empty
+	MapHeader         MapHeader            // where the columns of maps and ordered rows come from when MapColumns is empty
+	ExpandSlices      bool                 // Write expands the slice fields without a csv[] tag into as many indexed columns as their longest value
+	Dialect           Dialect              // syntax of the file, applied to the csv.Writer unless it is the zero value
+	nameNormalizer    Normalizer
+	virtualColumns    []virtualColumn // computed columns added with AddColumn
+}
+
+// columnFunc computes the cell of a column added with AddColumn from a record
+type columnFunc func(record any) (string, error)
+
+// virtualColumn is a column computed from each record instead of read from a struct field
+type virtualColumn struct {
+	name      string
+	compute   columnFunc
+	placement *ColumnPlacement
+}
+
+// ColumnPlacement tells where a column added with AddColumn goes among the columns of T, at the end by default.
+// The position is decided before SelectedColumns and SortOrder are applied.
+type ColumnPlacement struct {
+	after    string
+	before   string
+	position int // -1 when not set
+}
+
+// After places the column right after the column named column
+func (p *ColumnPlacement) After(column string) *ColumnPlacement {
+	p.after, p.before, p.position = column, "", -1
+	return p
+}
+
+// Before places the column right before the column named column
+func (p *ColumnPlacement) Before(column string) *ColumnPlacement {
+	p.after, p.before, p.position = "", column, -1
+	return p
+}
+
+// At places the column at the 0-based position
+func (p *ColumnPlacement) At(position int) *ColumnPlacement {
+	p.after, p.before, p.position = "", "", position
+	return p
+}
+
+// AddColumn adds a column named name whose cells are computed from each record by compute.
+// It takes part in SelectedColumns, SortOrder and HeaderModifier like the columns of the struct fields.
+func (x *XsvWrite[T]) AddColumn(name string, compute func(T) (string, error)) *ColumnPlacement {
+	placement := &ColumnPlacement{position: -1}
+	x.virtualColumns = append(x.virtualColumns, virtualColumn{
+		name: name,
+		compute: func(v any) (string, error) {
+			return compute(v.(T))
+		},
+		placement: placement,
+	})
+	return placement
+}
+
+// insertVirtualColumns inserts the columns added with AddColumn among the columns of the struct fields
+func (x *XsvWrite[T]) insertVirtualColumns(fieldInfos []fieldInfo) ([]fieldInfo, error) {
+	for _, column := range x.virtualColumns {
+		position := len(fieldInfos)
+		placement := column.placement
+		switch {
+		case placement.after != "" || placement.before != "":
+			name := placement.after + placement.before
+			position = slices.IndexFunc(fieldInfos, func(info fieldInfo) bool { return info.keys[0] == name })
+			if position < 0 {
+				return nil, fmt.Errorf("cannot place column %q next to unknown column %q", column.name, name)
+			}
+			if placement.after != "" {
+				position++
+			}
+		case placement.position >= 0:
+			if placement.position > len(fieldInfos) {
+				return nil, fmt.Errorf("cannot place column %q at position %d of %d columns", column.name, placement.position, len(fieldInfos))
+			}
+			position = placement.position
+		}
+		fieldInfos = slices.Insert(fieldInfos, position, fieldInfo{
+			keys:     []string{column.name},
+			position: -1,
+			compute:  column.compute,
+		})
+	}
+	return fieldInfos, nil
 }
 
 // NewXsvWrite creates a new XsvWrite struct with default configuration values
 func NewXsvWrite[T any]() XsvWrite[T] {
 	return XsvWrite[T]{
-		TagName:         "csv",
-		TagSeparator:    ",",
-		OmitHeaders:     false,
-		SelectedColumns: make([]string, 0),
-		SortOrder:       make([]int, 0),
-		HeaderModifier:  map[string]string{},
-		OnRecord:        nil,
-		nameNormalizer:  func(s string) string { return s },
+		TagName:           "csv",
+		TagSeparator:      ",",
+		OmitHeaders:       false,
+		SelectedColumns:   make([]string, 0),
+		SortOrder:         make([]int, 0),
+		Columns:           make([]string, 0),
+		HeaderModifier:    map[string]string{},
+		OnRecord:          nil,
+		QuotePolicy:       QuoteMinimal,
+		Quote:             '"',
+		Escape:            0,
+		FormulaProtection: FormulaAllow,
+		Footers:           map[string]Footer[T]{},
+		MapColumns:        make([]string, 0),
+		MapHeader:         MapHeaderFirstRow,
+		ExpandSlices:      false,
+		Dialect:           Dialect{},
+		nameNormalizer:    func(s string) string { return s },
 	}
 }
 
@@ -40,10 +143,56 @@ func (x *XsvWrite[T]) checkSortOrderSlice(outputFieldsCount int) error {
 		if len(x.SortOrder) != outputFieldsCount {
 			return errors.New(fmt.Sprintf("the length of the SortOrder array should be equal to the number of items to be output(%d)", outputFieldsCount))
 		}
+		seen := make([]bool, outputFieldsCount)
+		for _, to := range x.SortOrder {
+			if to < 0 || to >= outputFieldsCount || seen[to] {
+				return fmt.Errorf("the SortOrder array should be a permutation of 0 to %d, got %v", outputFieldsCount-1, x.SortOrder)
+			}
+			seen[to] = true
+		}
 	}
 	return nil
 }
 
+// getOrderedFieldInfos selects and orders the columns as listed in Columns, by name.
+// The columns that are not listed take the place of the "*" wildcard, in their order, or are left out without it.
+func (x *XsvWrite[T]) getOrderedFieldInfos(fieldInfos []fieldInfo) ([]fieldInfo, error) {
+	if len(x.SelectedColumns) > 0 || len(x.SortOrder) > 0 {
+		return nil, errors.New("cannot use Columns with SelectedColumns or SortOrder")
+	}
+	listed := make([]bool, len(fieldInfos))
+	wildcard := -1
+	orderedFieldInfos := make([]fieldInfo, 0, len(fieldInfos))
+	for _, name := range x.Columns {
+		if name == "*" {
+			if wildcard >= 0 {
+				return nil, errors.New("the wildcard \"*\" is listed more than once in Columns")
+			}
+			wildcard = len(orderedFieldInfos)
+			continue
+		}
+		i := slices.IndexFunc(fieldInfos, func(info fieldInfo) bool { return slices.Contains(info.keys, name) })
+		if i < 0 {
+			return nil, fmt.Errorf("%w %q in Columns", ErrUnknownColumn, name)
+		}
+		if listed[i] {
+			return nil, fmt.Errorf("column %q is listed more than once in Columns", name)
+		}
+		listed[i] = true
+		orderedFieldInfos = append(orderedFieldInfos, fieldInfos[i])
+	}
+	if wildcard >= 0 {
+		var others []fieldInfo
+		for i, info := range fieldInfos {
+			if !listed[i] {
+				others = append(others, info)
+			}
+		}
+		orderedFieldInfos = slices.Insert(orderedFieldInfos, wildcard, others...)
+	}
+	return orderedFieldInfos, nil
+}
+
 func (x *XsvWrite[T]) getSelectedFieldInfos(fieldInfos []fieldInfo) []fieldInfo {
 	if len(x.SelectedColumns) > 0 {
 		var selectedFieldInfos []fieldInfo
@@ -58,18 +207,66 @@ func (x *XsvWrite[T]) getSelectedFieldInfos(fieldInfos []fieldInfo) []fieldInfo
 	}
 }
 
+// SetWriter writes the csv with writer. Since the underlying io.Writer of a csv.Writer cannot be reached,
+// writing then fails with ErrQuotingWithoutWriter when QuotePolicy, Quote, Escape or the Comment of the Dialect
+// need xsv's own record writer: use SetIOWriter for those.
 func (x *XsvWrite[T]) SetWriter(writer *csv.Writer) (xw *XsvWriter[T]) {
 	xw = NewXsvWriter(*x)
 	xw.writer = writer
+	if x.Dialect.isSet() {
+		x.Dialect.applyToWriter(writer)
+		if xw.QuotePolicy == QuoteMinimal {
+			xw.QuotePolicy = x.Dialect.QuotePolicy
+		}
+	}
 	return xw
 }
 
-func (x *XsvWrite[T]) SetFileWriter(file *os.File) (xw *XsvWriter[T]) {
-	xw = x.SetWriter(csv.NewWriter(file))
+// SetIOWriter writes the csv to w, which may be any io.Writer such as an HTTP response, a pipe or a gzip writer
+func (x *XsvWrite[T]) SetIOWriter(w io.Writer) (xw *XsvWriter[T]) {
+	xw = x.SetWriter(csv.NewWriter(w))
+	xw.out = w
 	return xw
 }
 
+func (x *XsvWrite[T]) SetFileWriter(file *os.File) (xw *XsvWriter[T]) {
+	return x.SetIOWriter(file)
+}
+
 func (x *XsvWrite[T]) SetBufferWriter(buffer *bytes.Buffer) (xw *XsvWriter[T]) {
-	xw = x.SetWriter(csv.NewWriter(buffer))
-	return xw
+	return x.SetIOWriter(buffer)
+}
+
+// SetAppendFileWriter opens the file at name to append records to it, creating it if needed.
+// When the file already has a header, it must have the columns of the writer, after SelectedColumns, SortOrder and
+// HeaderModifier, in any order: the header is not written again and the records are written in the column order of the file,
+// with the line ending of its header line whatever UseCRLF.
+// Otherwise SetAppendFileWriter closes the file and returns ErrHeaderMismatch. When the columns cannot be known before
+// the first record, because T is an interface, or a map or an OrderedRow without MapColumns, or ExpandSlices is set,
+// the header is checked by the first write instead. Close closes the file.
+func (x *XsvWrite[T]) SetAppendFileWriter(name string) (xw *XsvWriter[T], err error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	xw = x.SetFileWriter(file)
+	xw.appendFile = file
+	inType := reflect.TypeOf((*T)(nil)).Elem()
+	if inType.Kind() == reflect.Interface || (isDynamicType(inType) && len(x.MapColumns) == 0) || x.ExpandSlices {
+		return xw, nil
+	}
+	if err := xw.columnPlan(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := xw.checkAppendFile(xw.header()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return xw, nil
+}
+
+// customQuoting tells whether the quoting options need xsv's own record writer instead of csv.Writer
+func (x *XsvWrite[T]) customQuoting() bool {
+	return x.QuotePolicy != QuoteMinimal || (x.Quote != 0 && x.Quote != '"') || x.Escape != 0 || x.Dialect.Comment != 0
 }
@@ -1,13 +1,42 @@
 package xsv
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
 	"reflect"
+	"slices"
 )
 
 type XsvWriter[T any] struct {
 	XsvWrite[T]
-	writer *csv.Writer
+	writer     *csv.Writer
+	out        io.Writer     // underlying writer of the csv.Writer when known, needed by records
+	records    *recordWriter // used instead of writer when the quoting options are not the ones of csv.Writer
+	appendFile *os.File      // opened by SetAppendFileWriter, closed by Close
+
+	// state of the file opened by SetAppendFileWriter
+	appendChecked   bool // its header has been compared with the columns of the writer
+	appendHasHeader bool // it already has a header, which is not written again
+
+	// column plan computed from T on first use by WriteHeader and WriteRow
+	planned           bool
+	inType            reflect.Type            // type of the written values, the dynamic type of the first one when T is an interface
+	rowColumns        []string                // columns of the maps and ordered rows taken from the rows, when MapColumns is empty
+	sliceLengths      map[string]int          // number of columns of the slice fields scanned by Write when ExpandSlices is set
+	fields            []fieldInfo             // selected fields in the sort order
+	numeric           []bool                  // fields of numeric types, for QuoteNonNumeric
+	footers           []*footerAccumulator[T] // accumulators of the columns with a footer, nil for the other columns
+	inInnerWasPointer bool
+	row               []string // record buffer reused for each row
+	headerWritten     bool
+	footerWritten     bool
+	closed            bool
 }
 
 func NewXsvWriter[T any](xsvWrite XsvWrite[T]) *XsvWriter[T] {
@@ -24,120 +53,486 @@ func (xw *XsvWriter[T]) UseCRLF(useCRLF bool) *XsvWriter[T] {
 	return xw
 }
 
-func (xw *XsvWriter[T]) Write(data []T) error {
-	inValue, inType := getConcreteReflectValueAndType(data) // Get the concrete type (not pointer) (Slice<?> or Array<?>)
+// columnPlan computes once the columns written for T: the selected fields in the sort order
+func (xw *XsvWriter[T]) columnPlan() error {
+	return xw.columnPlanFor(reflect.TypeOf((*T)(nil)).Elem())
+}
 
-	inInnerWasPointer, inInnerType := getConcreteContainerInnerType(inType) // Get the concrete inner type (not pointer) (Container<"?">)
-	if err := ensureInInnerType(inInnerType); err != nil {
+// columnPlanFor computes once the columns written for the values of type inType
+func (xw *XsvWriter[T]) columnPlanFor(inType reflect.Type) error {
+	if xw.planned {
+		return nil
+	}
+	var fieldInfos []fieldInfo
+	inInnerWasPointer, inInnerType := false, inType
+	if isDynamicType(inType) {
+		columns := xw.MapColumns
+		if len(columns) == 0 {
+			columns = xw.rowColumns
+		}
+		if len(columns) == 0 {
+			return ErrNoMapColumns
+		}
+		fieldInfos = dynamicFieldInfos(columns)
+	} else {
+		inInnerWasPointer, inInnerType = getConcreteContainerInnerType(reflect.SliceOf(inType)) // Get the concrete inner type (not pointer) (Container<"?">)
+		if err := ensureInInnerType(inInnerType); err != nil {
+			return err
+		}
+		if xw.ExpandSlices && xw.sliceLengths == nil {
+			return ErrExpandSlices
+		}
+		fieldInfos = getExpandedFieldInfos(inInnerType, []int{}, []string{}, xw.TagName, xw.TagSeparator, xw.nameNormalizer, xw.sliceLengths) // Get the inner struct info to get CSV annotations
+	}
+	// the fields with an order= tag option come first, sorted by it, and the others follow in the order of the struct
+	slices.SortStableFunc(fieldInfos, func(a, b fieldInfo) int {
+		if a.ordered != b.ordered {
+			if a.ordered {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.order, b.order)
+	})
+	fieldInfos, err := xw.insertVirtualColumns(fieldInfos)
+	if err != nil {
 		return err
 	}
+	if len(xw.Columns) > 0 {
+		if xw.fields, err = xw.getOrderedFieldInfos(fieldInfos); err != nil {
+			return err
+		}
+	} else {
+		fieldInfos = xw.getSelectedFieldInfos(fieldInfos)
+		if err := xw.checkSortOrderSlice(len(fieldInfos)); err != nil {
+			return err
+		}
+		xw.fields = reorderColumns[fieldInfo](fieldInfos, xw.SortOrder)
+	}
+	xw.inType = inType
+	xw.numeric = make([]bool, len(xw.fields))
+	xw.footers = make([]*footerAccumulator[T], len(xw.fields))
+	for i, fieldInfo := range xw.fields {
+		kind := reflect.Invalid
+		if fieldInfo.compute == nil {
+			fieldType := fieldTypeByIndex(inInnerType, fieldInfo.IndexChain)
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			kind = fieldType.Kind()
+			xw.numeric[i] = isNumberKind(kind)
+		}
+		if footer, ok := xw.Footers[fieldInfo.getFirstKey()]; ok && footer.Kind != FooterNone {
+			xw.footers[i] = newFooterAccumulator(footer, fieldInfo.getFirstKey(), kind)
+		}
+	}
+	xw.inInnerWasPointer = inInnerWasPointer
+	xw.row = make([]string, len(xw.fields))
+	xw.planned = true
+	return nil
+}
 
-	fieldInfos := getFieldInfos(inInnerType, []int{}, []string{}, xw.TagName, xw.TagSeparator, xw.nameNormalizer) // Get the inner struct info to get CSV annotations
-	fieldInfos = xw.getSelectedFieldInfos(fieldInfos)
-	if err := xw.checkSortOrderSlice(len(fieldInfos)); err != nil {
+// WriteHeader writes the header line, unless OmitHeaders is set.
+// WriteRow writes it before the first row, so it only needs to be called to write a file that may have no rows.
+func (xw *XsvWriter[T]) WriteHeader() error {
+	if xw.closed {
+		return ErrWriterClosed
+	}
+	if xw.headerWritten {
+		return ErrHeaderWritten
+	}
+	if err := xw.columnPlan(); err != nil {
 		return err
 	}
-	fieldInfos = reorderColumns[fieldInfo](fieldInfos, xw.SortOrder)
-	inInnerStructInfo := &structInfo{fieldInfos}
+	xw.headerWritten = true
+	header := xw.header()
+	if xw.appendFile != nil {
+		if !xw.appendChecked {
+			if err := xw.checkAppendFile(header); err != nil {
+				return err
+			}
+		}
+		if xw.appendHasHeader {
+			return nil
+		}
+	}
+	if xw.OmitHeaders {
+		return nil
+	}
+	return xw.writeRecord(header, nil)
+}
 
-	csvHeadersLabels := make([]string, len(inInnerStructInfo.Fields))
-	for i, fieldInfo := range inInnerStructInfo.Fields { // Used to write the header (first line) in CSV
+// header returns the names of the columns, in the record buffer.
+// They are protected like the cells since the columns of maps, ordered rows and AddColumn are named by data.
+func (xw *XsvWriter[T]) header() []string {
+	for i, fieldInfo := range xw.fields { // Used to write the header (first line) in CSV
 		if newHeader, ok := xw.HeaderModifier[fieldInfo.getFirstKey()]; ok { // modify header name dynamically
-			csvHeadersLabels[i] = newHeader
+			xw.row[i] = newHeader
 		} else {
-			csvHeadersLabels[i] = fieldInfo.getFirstKey()
+			xw.row[i] = fieldInfo.getFirstKey()
+		}
+		xw.row[i] = protectFormula(xw.row[i], xw.FormulaProtection)
+	}
+	return xw.row
+}
+
+// checkAppendFile compares the header of the file opened by SetAppendFileWriter with the columns of the writer, see alignWithFile
+func (xw *XsvWriter[T]) checkAppendFile(header []string) error {
+	hasHeader, err := xw.alignWithFile(header)
+	if err != nil {
+		return err
+	}
+	xw.appendChecked, xw.appendHasHeader = true, hasHeader
+	return nil
+}
+
+// alignWithFile reads the header of the file opened by SetAppendFileWriter, if it is not empty.
+// It checks that the file has the columns of header and reorders the columns of the writer in the order of the file,
+// and makes the writer end its lines like the header line.
+func (xw *XsvWriter[T]) alignWithFile(header []string) (hasHeader bool, err error) {
+	info, err := xw.appendFile.Stat()
+	if err != nil {
+		return false, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return false, nil
+	}
+
+	reader := csv.NewReader(io.NewSectionReader(xw.appendFile, 0, size))
+	if xw.Dialect.isSet() {
+		xw.Dialect.applyToReader(reader)
+	}
+	reader.Comma = xw.writer.Comma
+	fileHeader, err := reader.Read()
+	if err != nil {
+		return false, err
+	}
+	order, err := headerOrder(fileHeader, header)
+	if err != nil {
+		return false, err
+	}
+	fields := make([]fieldInfo, len(order))
+	numeric := make([]bool, len(order))
+	footers := make([]*footerAccumulator[T], len(order))
+	for i, j := range order {
+		fields[i] = xw.fields[j]
+		numeric[i] = xw.numeric[j]
+		footers[i] = xw.footers[j]
+	}
+	xw.fields, xw.numeric, xw.footers = fields, numeric, footers
+
+	// the records take the line ending of the header, and must start on a new line
+	firstLine, err := bufio.NewReader(io.NewSectionReader(xw.appendFile, 0, size)).ReadBytes('\n')
+	if err == nil {
+		xw.writer.UseCRLF = bytes.HasSuffix(firstLine, []byte("\r\n"))
+	}
+	last := make([]byte, 1)
+	if _, err := xw.appendFile.ReadAt(last, size-1); err != nil {
+		return false, err
+	}
+	if last[0] != '\n' {
+		lineBreak := "\n"
+		if xw.writer.UseCRLF {
+			lineBreak = "\r\n"
+		}
+		if _, err := xw.appendFile.WriteString(lineBreak); err != nil {
+			return false, err
 		}
 	}
-	if !xw.OmitHeaders {
-		if err := xw.writer.Write(csvHeadersLabels); err != nil {
+	return true, nil
+}
+
+// headerOrder returns, for each column of fileHeader, the index of the same column in header.
+// It fails with ErrHeaderMismatch when the two headers do not have the same columns.
+func headerOrder(fileHeader, header []string) ([]int, error) {
+	positions := map[string][]int{} // column name -> indexes in header, for duplicated names
+	for j, column := range header {
+		positions[column] = append(positions[column], j)
+	}
+	order := make([]int, 0, len(fileHeader))
+	var unexpected []string
+	for _, column := range fileHeader {
+		if len(positions[column]) == 0 {
+			unexpected = append(unexpected, column)
+			continue
+		}
+		order = append(order, positions[column][0])
+		positions[column] = positions[column][1:]
+	}
+	var missing []string
+	for _, column := range header {
+		if len(positions[column]) > 0 {
+			missing = append(missing, column)
+			positions[column] = positions[column][1:]
+		}
+	}
+	if len(missing) > 0 || len(unexpected) > 0 {
+		return nil, fmt.Errorf("%w: missing columns %q, unexpected columns %q in %q", ErrHeaderMismatch, missing, unexpected, fileHeader)
+	}
+	return order, nil
+}
+
+// WriteRow writes one record, after the header if it has not been written yet.
+// Records are buffered until Flush or Close is called.
+func (xw *XsvWriter[T]) WriteRow(v T) error {
+	if xw.closed {
+		return ErrWriterClosed
+	}
+	if xw.footerWritten {
+		return ErrFooterWritten
+	}
+	if xw.OnRecord != nil {
+		v = xw.OnRecord(v)
+	}
+	inValue := reflect.ValueOf(&v).Elem()
+	// when T is an interface, write its dynamic value
+	isInterface := inValue.Kind() == reflect.Interface
+	if isInterface {
+		if inValue.IsNil() {
+			return fmt.Errorf("cannot write a nil %v", inValue.Type())
+		}
+		inValue = addressable(inValue.Elem())
+	}
+	if !xw.planned && len(xw.MapColumns) == 0 && xw.rowColumns == nil && isDynamicType(inValue.Type()) {
+		if xw.MapHeader == MapHeaderUnion {
+			return ErrMapHeaderUnion
+		}
+		xw.rowColumns = rowColumns(inValue)
+	}
+	if isInterface {
+		if err := xw.columnPlanFor(inValue.Type()); err != nil {
 			return err
 		}
+		if inValue.Type() != xw.inType {
+			return fmt.Errorf("cannot write %v with the columns of %v", inValue.Type(), xw.inType)
+		}
 	}
-	inLen := inValue.Len()
-	for i := 0; i < inLen; i++ { // Iterate over container rows
-		inValueByIndex := inValue.Index(i)
-		if xw.OnRecord != nil {
-			inValueByIndex = reflect.ValueOf(xw.OnRecord(inValue.Index(i).Interface().(T)))
+	if !xw.headerWritten {
+		if err := xw.WriteHeader(); err != nil {
+			return err
 		}
-		for j, fieldInfo := range inInnerStructInfo.Fields {
-			csvHeadersLabels[j] = ""
-			inInnerFieldValue, err := getInnerField(inValueByIndex, inInnerWasPointer, fieldInfo.IndexChain) // Get the correct field header <-> position
-			if err != nil {
+	}
+	for j, fieldInfo := range xw.fields {
+		var inInnerFieldValue string
+		var err error
+		if fieldInfo.compute != nil {
+			inInnerFieldValue, err = fieldInfo.compute(v)
+		} else {
+			inInnerFieldValue, err = getInnerField(inValue, xw.inInnerWasPointer, fieldInfo.IndexChain, fieldInfo.format) // Get the correct field header <-> position
+		}
+		if err != nil {
+			return err
+		}
+		if footer := xw.footers[j]; footer != nil {
+			value := inInnerFieldValue
+			if fieldInfo.format != nil && footer.needsNumbers() {
+				if value, err = getInnerField(inValue, xw.inInnerWasPointer, fieldInfo.IndexChain, nil); err != nil {
+					return err
+				}
+			}
+			if err := footer.add(v, value); err != nil {
 				return err
 			}
-			csvHeadersLabels[j] = inInnerFieldValue
 		}
-		if err := xw.writer.Write(csvHeadersLabels); err != nil {
-			return err
+		if !fieldInfo.raw {
+			inInnerFieldValue = protectFormula(inInnerFieldValue, xw.FormulaProtection)
 		}
+		xw.row[j] = inInnerFieldValue
 	}
-	xw.writer.Flush()
-	return xw.writer.Error()
+	return xw.writeRecord(xw.row, xw.numeric)
 }
 
-func (xw *XsvWriter[T]) WriteFromChan(dataChan chan T) error {
-	// Get the first value. It wil determine the header structure.
-	firstValue, ok := <-dataChan
-	if !ok {
-		return ErrChannelIsClosed
+// WriteFooter writes the footer row computed from the records written so far, when Footers is not empty.
+// Write, WriteFromChan and Close call it, no record can be written afterwards.
+func (xw *XsvWriter[T]) WriteFooter() error {
+	if xw.closed {
+		return ErrWriterClosed
 	}
-	inValue, inType := getConcreteReflectValueAndType(firstValue) // Get the concrete type
-	if err := ensureStructOrPtr(inType); err != nil {
-		return err
+	if xw.footerWritten {
+		return ErrFooterWritten
 	}
-	inInnerWasPointer := inType.Kind() == reflect.Ptr
-	fieldInfos := getFieldInfos(inType, []int{}, []string{}, xw.TagName, xw.TagSeparator, xw.nameNormalizer) // Get the inner struct info to get CSV annotations
-	fieldInfos = xw.getSelectedFieldInfos(fieldInfos)
-	if err := xw.checkSortOrderSlice(len(fieldInfos)); err != nil {
-		return err
+	if len(xw.Footers) == 0 {
+		return nil
 	}
-	fieldInfos = reorderColumns[fieldInfo](fieldInfos, xw.SortOrder)
-	inInnerStructInfo := &structInfo{fieldInfos}
-	csvHeadersLabels := make([]string, len(inInnerStructInfo.Fields))
-	for i, fieldInfo := range inInnerStructInfo.Fields { // Used to Write the header (first line) in CSV
-		if newHeader, ok := xw.HeaderModifier[fieldInfo.getFirstKey()]; ok { // modify header name dynamically
-			csvHeadersLabels[i] = newHeader
-		} else {
-			csvHeadersLabels[i] = fieldInfo.getFirstKey()
+	if !xw.headerWritten {
+		if err := xw.WriteHeader(); err != nil {
+			return err
 		}
 	}
-
-	if !xw.OmitHeaders {
-		if err := xw.writer.Write(csvHeadersLabels); err != nil {
+	xw.footerWritten = true
+	for j, footer := range xw.footers {
+		xw.row[j] = ""
+		if footer == nil {
+			continue
+		}
+		cell, err := footer.result(xw.fields[j].format)
+		if err != nil {
 			return err
 		}
+		if !xw.fields[j].raw {
+			cell = protectFormula(cell, xw.FormulaProtection)
+		}
+		xw.row[j] = cell
 	}
-	write := func(val reflect.Value) error {
-		if xw.OnRecord != nil {
-			val = reflect.ValueOf(xw.OnRecord(val.Interface().(T)))
+	return xw.writeRecord(xw.row, xw.numeric)
+}
+
+// writeRecord writes a record with the csv.Writer, or with xsv's own record writer when custom quoting options are set.
+// numeric tells which fields come from numeric struct fields, it is nil for the header.
+func (xw *XsvWriter[T]) writeRecord(record []string, numeric []bool) error {
+	if !xw.customQuoting() {
+		return xw.writer.Write(record)
+	}
+	if xw.records == nil {
+		if xw.out == nil {
+			return ErrQuotingWithoutWriter
 		}
-		for j, fieldInfo := range inInnerStructInfo.Fields {
-			csvHeadersLabels[j] = ""
-			inInnerFieldValue, err := getInnerField(val, inInnerWasPointer, fieldInfo.IndexChain) // Get the correct field header <-> position
-			if err != nil {
-				return err
-			}
-			csvHeadersLabels[j] = inInnerFieldValue
+		if xw.Dialect.QuotePolicy == QuoteNone {
+			return ErrDialectQuoteNone
 		}
-		if err := xw.writer.Write(csvHeadersLabels); err != nil {
+		records, err := newRecordWriter(xw.out, xw.writer.Comma, xw.writer.UseCRLF, xw.QuotePolicy, xw.Quote, xw.Escape)
+		if err != nil {
+			return err
+		}
+		records.comment = xw.Dialect.Comment
+		xw.records = records
+	}
+	return xw.records.write(record, numeric)
+}
+
+// WriteRows writes the records in order, see WriteRow.
+func (xw *XsvWriter[T]) WriteRows(data []T) error {
+	for _, v := range data {
+		if err := xw.WriteRow(v); err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+// Flush writes the buffered records to the underlying writer and returns the error of the csv writer, if any.
+func (xw *XsvWriter[T]) Flush() error {
+	if xw.records != nil {
+		return xw.records.flush()
+	}
+	xw.writer.Flush()
+	return xw.writer.Error()
+}
+
+// Close writes the footer if needed, flushes the buffered records, and closes the file opened by SetAppendFileWriter.
+// Writing after Close returns ErrWriterClosed.
+func (xw *XsvWriter[T]) Close() error {
+	if xw.closed {
 		return nil
 	}
-	if err := write(inValue); err != nil {
-		return err
+	var err error
+	if !xw.footerWritten && xw.headerWritten {
+		err = xw.WriteFooter()
+	}
+	xw.closed = true
+	if flushErr := xw.Flush(); err == nil {
+		err = flushErr
+	}
+	if xw.appendFile != nil {
+		if closeErr := xw.appendFile.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Write writes the header and data, then flushes the writer.
+// The header is written by the first call only: calling Write again on the same writer appends data after the records already written,
+// and fails with ErrFooterWritten when Footers is not empty since the footer has been written.
+// The columns of maps and ordered rows are taken from data as told by MapHeader when MapColumns is empty,
+// and the slice fields are expanded to the longest slice of data when ExpandSlices is set.
+func (xw *XsvWriter[T]) Write(data []T) error {
+	if !xw.planned && len(xw.MapColumns) == 0 && xw.rowColumns == nil {
+		xw.rowColumns = dataColumns(data, xw.MapHeader)
+	}
+	if !xw.planned && xw.ExpandSlices && xw.sliceLengths == nil {
+		xw.sliceLengths = map[string]int{}
+		for _, v := range data {
+			scanSliceLengths(reflect.ValueOf(v), []int{}, xw.TagName, xw.sliceLengths)
+		}
 	}
-	for v := range dataChan {
-		val, _ := getConcreteReflectValueAndType(v) // Get the concrete type (not pointer) (Slice<?> or Array<?>)
-		if err := ensureStructOrPtr(inType); err != nil {
+	if !xw.headerWritten {
+		if err := xw.WriteHeader(); err != nil {
 			return err
 		}
-		if err := write(val); err != nil {
+	}
+	if err := xw.WriteRows(data); err != nil {
+		return err
+	}
+	if err := xw.WriteFooter(); err != nil {
+		return err
+	}
+	return xw.Flush()
+}
+
+func (xw *XsvWriter[T]) WriteFromChan(dataChan chan T) error {
+	return xw.WriteFromChanContext(context.Background(), dataChan)
+}
+
+// WriteFromChanContext writes the header, then each value received from dataChan until it is closed, and flushes the writer.
+// An empty stream produces a header-only file. The header is taken from T, or from the first value when T is an interface,
+// or a map or an OrderedRow without MapColumns, in which case ErrChannelIsClosed is returned for an empty stream.
+// When ctx is done the rows written so far are flushed and ctx.Err() is returned.
+func (xw *XsvWriter[T]) WriteFromChanContext(ctx context.Context, dataChan <-chan T) error {
+	inType := reflect.TypeOf((*T)(nil)).Elem()
+	fromFirstValue := inType.Kind() == reflect.Interface || (isDynamicType(inType) && len(xw.MapColumns) == 0)
+	if !xw.headerWritten && !fromFirstValue {
+		if err := xw.WriteHeader(); err != nil {
 			return err
 		}
 	}
-	xw.writer.Flush()
-	return xw.writer.Error()
+	for {
+		select {
+		case v, ok := <-dataChan:
+			if !ok {
+				if !xw.headerWritten {
+					return ErrChannelIsClosed
+				}
+				if err := xw.WriteFooter(); err != nil {
+					return err
+				}
+				return xw.Flush()
+			}
+			if err := xw.WriteRow(v); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			if err := xw.Flush(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// dataColumns returns the columns of data, a slice of maps or ordered rows, as told by mapHeader.
+// It returns nil for an empty slice and for the other types.
+func dataColumns[T any](data []T, mapHeader MapHeader) []string {
+	var columns []string
+	seen := map[string]bool{}
+	for _, v := range data {
+		row := reflect.ValueOf(v)
+		if !row.IsValid() || !isDynamicType(row.Type()) {
+			return nil
+		}
+		if mapHeader != MapHeaderUnion {
+			return rowColumns(row)
+		}
+		for _, column := range rowColumns(row) {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	slices.Sort(columns)
+	return columns
 }
 
 func reorderColumns[T any](row []T, sortOrder []int) []T {